@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent"
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/config/secret"
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/encryption"
+
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	optionKey = "key"
+	stdio     = "-"
+)
+
+var decryptCommand = &cli.Command{
+	Name:      "decrypt",
+	Usage:     "decrypts a snapshot encrypted by the agent",
+	ArgsUsage: "<encrypted-snapshot> <output-file>",
+	Description: "decrypts the given snapshot using the key configured in snapshots.encryption or the key given via --key;\n" +
+		"specify '-' as input or output to read from stdin or write to stdout",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    optionKey,
+			Aliases: []string{"k"},
+			Usage:   "use the base64-encoded encryption-key specified by `SECRET` (plain value, env://<variable> or file://<path>) instead of the configured key",
+			EnvVars: []string{agentOptions.EnvPrefix + "_ENCRYPTION_KEY"},
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() != 2 {
+			return cli.ShowSubcommandHelp(ctx)
+		}
+
+		encryptionConfig, err := decryptionConfig(ctx.String(optionKey))
+		if err != nil {
+			return err
+		}
+
+		input, err := openInput(ctx.Args().Get(0))
+		if err != nil {
+			return err
+		}
+		defer input.Close()
+
+		return writeOutput(ctx.Args().Get(1), func(w io.Writer) error {
+			return encryptionConfig.Decrypt(w, input)
+		})
+	},
+}
+
+func decryptionConfig(key string) (encryption.EncryptionConfig, error) {
+	if key != "" {
+		return encryption.EncryptionConfig{Key: secret.FromString(key)}, nil
+	}
+
+	config, err := agent.ReadConfig(agentOptions)
+	if err != nil {
+		return encryption.EncryptionConfig{}, err
+	}
+
+	if config.Snapshots.Encryption == nil {
+		return encryption.EncryptionConfig{}, errors.New("no encryption configured, please specify the key via --key")
+	}
+
+	return *config.Snapshots.Encryption, nil
+}
+
+// openInput opens the given file or stdin if file is "-"
+func openInput(file string) (io.ReadCloser, error) {
+	if file == stdio {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(file)
+}
+
+// writeOutput passes the given file or stdout if file is "-" to write.
+// If write fails, the file is removed.
+func writeOutput(file string, write func(io.Writer) error) error {
+	if file == stdio {
+		return write(os.Stdout)
+	}
+
+	output, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+
+	if err := write(output); err != nil {
+		_ = output.Close()
+		_ = os.Remove(file)
+		return err
+	}
+
+	return output.Close()
+}
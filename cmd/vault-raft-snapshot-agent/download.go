@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io"
+
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent"
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/logging"
+
+	"github.com/urfave/cli/v2"
+)
+
+var downloadCommand = &cli.Command{
+	Name:      "download",
+	Usage:     "downloads a snapshot from a configured storage",
+	ArgsUsage: "[snapshot-name] <output-file>",
+	Description: "downloads the given or the latest snapshot from the storage, decrypts and decompresses it\n" +
+		"if encryption or compression is configured;\n" +
+		"specify '-' as output to write to stdout",
+	Flags: []cli.Flag{
+		storageFlag,
+	},
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() < 1 || ctx.NArg() > 2 {
+			return cli.ShowSubcommandHelp(ctx)
+		}
+
+		name, output := "", ctx.Args().Get(0)
+		if ctx.NArg() == 2 {
+			name, output = ctx.Args().Get(0), ctx.Args().Get(1)
+		}
+
+		config, err := agent.ReadConfig(agentOptions)
+		if err != nil {
+			return err
+		}
+
+		controller, err := createStorageController(ctx.Context, config.Snapshots.Storages, ctx.String(optionStorage))
+		if err != nil {
+			return err
+		}
+		defer func() { _ = controller.Close() }()
+
+		selected, err := selectSnapshot(ctx.Context, controller, name, config.Snapshots.StorageConfigDefaults)
+		if err != nil {
+			return err
+		}
+
+		logging.Info("Downloading snapshot", "snapshot", selected.Name)
+		data, err := controller.DownloadSnapshot(ctx.Context, selected.Name, config.Snapshots.StorageConfigDefaults)
+		if err != nil {
+			return err
+		}
+		defer data.Close()
+
+		return writeOutput(output, func(w io.Writer) error {
+			_, err := io.Copy(w, data)
+			return err
+		})
+	},
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent"
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/storage"
+
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	optionFormat = "format"
+	formatTable  = "table"
+	formatJSON   = "json"
+)
+
+var listCommand = &cli.Command{
+	Name:        "list",
+	Usage:       "lists the snapshots in all configured storages",
+	Description: "lists name, storage, size and modification-time of the snapshots in all configured storages, newest first",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  optionFormat,
+			Usage: "output-format of the list; possible values are 'table' or 'json'",
+			Value: formatTable,
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() > 0 {
+			return cli.ShowSubcommandHelp(ctx)
+		}
+
+		format := ctx.String(optionFormat)
+		if format != formatTable && format != formatJSON {
+			return fmt.Errorf("unknown format %s", format)
+		}
+
+		config, err := agent.ReadConfig(agentOptions)
+		if err != nil {
+			return err
+		}
+
+		manager := storage.CreateManager(config.Snapshots.Storages)
+		snapshots, listErr := manager.ListSnapshots(ctx.Context, config.Snapshots.StorageConfigDefaults)
+
+		if format == formatJSON {
+			err = printSnapshotsAsJSON(os.Stdout, snapshots)
+		} else {
+			err = printSnapshotsAsTable(os.Stdout, snapshots)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		// the snapshots of the available storages are printed even if some storages could not be listed
+		return listErr
+	},
+}
+
+func printSnapshotsAsTable(w io.Writer, snapshots []storage.StoredSnapshot) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(table, "NAME\tSTORAGE\tSIZE\tLAST MODIFIED")
+	for _, s := range snapshots {
+		_, _ = fmt.Fprintf(table, "%s\t%s\t%d\t%s\n", s.Name, s.Destination, s.Size, s.LastModified.Local().Format(time.RFC3339))
+	}
+	return table.Flush()
+}
+
+func printSnapshotsAsJSON(w io.Writer, snapshots []storage.StoredSnapshot) error {
+	if snapshots == nil {
+		snapshots = []storage.StoredSnapshot{}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(snapshots)
+}
@@ -5,7 +5,24 @@ or an AWS S3 Bucket.
 
 Usage:
 
-	vault-raft-snapshot-agent [flags] [options]
+	vault-raft-snapshot-agent [flags] [options] [command [command options] [arguments...]]
+
+The commands are:
+
+	decrypt <encrypted-snapshot> <output-file>
+		Decrypts a snapshot encrypted by the agent
+
+	download [-storage <name>] [snapshot-name] <output-file>
+		Downloads the given or the latest snapshot from a configured storage
+
+	list [-format table|json]
+		Lists the snapshots in all configured storages
+
+	restore [-storage <name>] [-force] [snapshot-name]
+		Restores the given or the latest snapshot from a configured storage
+
+	validate [-check-connectivity]
+		Validates the configuration and optionally checks that vault and the storages are accessible
 
 The flags are:
 
@@ -26,6 +43,9 @@ The options are:
 	-o -log-output [stderr|stdout|<file>]
 		Specifies the output to log to (default: stderr)
 
+	-once
+		Takes a single snapshot, uploads it to all storages and exits
+
 If no config file is explicitly specified, the program looks for configuration-files
 with the name `snapshots` and the extensions supported by [viper]
 in the current working directory or in /etc/vault.d/.
@@ -42,10 +62,12 @@ import (
 	"fmt"
 	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent"
 	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/logging"
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/vault"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/urfave/cli/v2"
 )
@@ -57,6 +79,7 @@ var agentOptions = agent.SnapshotAgentOptions{
 	ConfigFileName:        "snapshots",
 	ConfigFileSearchPaths: []string{"/etc/vault.d/", "."},
 	EnvPrefix:             "VRSA",
+	Version:               Version,
 }
 
 const (
@@ -64,6 +87,7 @@ const (
 	optionLogFormat = "log-format"
 	optionLogOutput = "log-output"
 	optionLogLevel  = "log-level"
+	optionOnce      = "once"
 )
 
 var cliFlags = []cli.Flag{
@@ -94,6 +118,11 @@ var cliFlags = []cli.Flag{
 		EnvVars: []string{agentOptions.EnvPrefix + "_LOG_LEVEL"},
 		Value:   logging.LevelInfo,
 	},
+	&cli.BoolFlag{
+		Name:    optionOnce,
+		Usage:   "take a single snapshot, upload it to all storages and exit; exits with a non-zero status if any upload fails",
+		EnvVars: []string{agentOptions.EnvPrefix + "_ONCE"},
+	},
 }
 
 type quietBoolFlag struct {
@@ -126,29 +155,42 @@ func main() {
 		Version:     Version,
 		Description: "takes periodic snapshot of vault's raft-db",
 		Flags:       cliFlags,
-		Action: func(ctx *cli.Context) error {
+		Commands: []*cli.Command{
+			decryptCommand,
+			downloadCommand,
+			listCommand,
+			restoreCommand,
+			validateCommand,
+		},
+		Before: func(ctx *cli.Context) error {
 			err := logging.Configure(ctx.String(optionLogOutput), ctx.String(optionLogFormat), ctx.String(optionLogLevel))
 			if err != nil {
 				log.Fatalf("could not configure logging: %s", err)
 			}
 
 			agentOptions.ConfigFilePath = ctx.Path(optionConfig)
-			return run()
+			return nil
+		},
+		Action: func(ctx *cli.Context) error {
+			return run(ctx.Bool(optionOnce))
 		},
 	}
-	app.CustomAppHelpTemplate = `Usage: {{.HelpName}} [options]
+	app.CustomAppHelpTemplate = `Usage: {{.HelpName}} [options] [command [command options] [arguments...]]
 {{.Description}}
 
+Commands:
+{{range .VisibleCommands}}{{"\t"}}{{join .Names ", "}}{{"\t"}}{{.Usage}}
+{{end}}
 Options:
 {{range $index, $option := .VisibleFlags}}{{if $index}}
 {{end}}{{$option}}{{end}}`
 
 	if err := app.Run(os.Args); err != nil {
-		logging.Fatal("Could not start agent", "error", err)
+		logging.Fatal("Could not run agent", "error", err)
 	}
 }
 
-func run() error {
+func run(once bool) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -159,9 +201,22 @@ func run() error {
 		cancel()
 	}()
 
+	if once {
+		return runOnce(ctx)
+	}
 	return runAgent(ctx)
 }
 
+func runOnce(ctx context.Context) error {
+	snapshotAgent, err := agent.CreateSnapshotAgent(ctx, agentOptions)
+	if err != nil {
+		return err
+	}
+
+	defer closeAgent(snapshotAgent)
+	return snapshotAgent.TakeSingleSnapshot(ctx)
+}
+
 func runAgent(ctx context.Context) error {
 	snapshotAgent, err := agent.CreateSnapshotAgent(ctx, agentOptions)
 	if err != nil {
@@ -172,9 +227,35 @@ func runAgent(ctx context.Context) error {
 		nextSnapshotTicker := snapshotAgent.TakeSnapshot(ctx)
 		select {
 		case <-ctx.Done():
+			closeAgent(snapshotAgent)
 			os.Exit(0)
 		case <-nextSnapshotTicker.C:
 			break
 		}
 	}
 }
+
+// closeTimeout limits the time to revoke the token obtained from vault
+const closeTimeout = 10 * time.Second
+
+// closeAgent revokes the token obtained from vault.
+// It does not use the agent's context as it is already cancelled on shutdown
+func closeAgent(snapshotAgent *agent.SnapshotAgent) {
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+
+	if err := snapshotAgent.Close(ctx); err != nil {
+		logging.Warn("Could not close agent", "error", err)
+	}
+}
+
+// closeClient revokes the token the client obtained from vault.
+// Like closeAgent, it does not use the context of the command as it is cancelled by SIGINT or SIGTERM
+func closeClient(client *vault.VaultClient) {
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+
+	if err := client.Close(ctx); err != nil {
+		logging.Warn("Could not close vault-client", "error", err)
+	}
+}
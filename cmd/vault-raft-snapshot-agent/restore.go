@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent"
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/logging"
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/raft"
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/vault"
+
+	"github.com/urfave/cli/v2"
+)
+
+const optionForce = "force"
+
+var restoreCommand = &cli.Command{
+	Name:      "restore",
+	Usage:     "restores a snapshot from a configured storage",
+	ArgsUsage: "[snapshot-name]",
+	Description: "downloads the given or the latest snapshot from the storage, verifies it and restores it on the leader-node\n" +
+		"of the configured vault-cluster using the configured authentication",
+	Flags: []cli.Flag{
+		storageFlag,
+		&cli.BoolFlag{
+			Name:  optionForce,
+			Usage: "restore the snapshot even if its unseal-keys do not match those of the vault-cluster",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() > 1 {
+			return cli.ShowSubcommandHelp(ctx)
+		}
+
+		config, err := agent.ReadConfig(agentOptions)
+		if err != nil {
+			return err
+		}
+
+		controller, err := createStorageController(ctx.Context, config.Snapshots.Storages, ctx.String(optionStorage))
+		if err != nil {
+			return err
+		}
+		defer func() { _ = controller.Close() }()
+
+		selected, err := selectSnapshot(ctx.Context, controller, ctx.Args().First(), config.Snapshots.StorageConfigDefaults)
+		if err != nil {
+			return err
+		}
+
+		// the stored size of compressed or encrypted snapshots does not tell how much space the restored snapshot needs,
+		// so only minFreeSpace is checked and insufficient space is reported by writing the snapshot
+		snapshot, err := config.Snapshots.Buffer.CreateTempFile(0)
+		if err != nil {
+			return err
+		}
+
+		defer func() {
+			_ = snapshot.Close()
+			_ = os.Remove(snapshot.Name())
+		}()
+
+		logging.Info("Downloading snapshot", "snapshot", selected.Name)
+		data, err := controller.DownloadSnapshot(ctx.Context, selected.Name, config.Snapshots.StorageConfigDefaults)
+		if err != nil {
+			return err
+		}
+		defer data.Close()
+
+		if _, err := io.Copy(snapshot, data); err != nil {
+			return fmt.Errorf("could not download snapshot %s to %s: %w", selected.Name, snapshot.Name(), err)
+		}
+
+		client, err := vault.CreateClient(config.Vault)
+		if err != nil {
+			return err
+		}
+		defer closeClient(client)
+
+		return restoreSnapshot(ctx.Context, client, snapshot, ctx.Bool(optionForce))
+	},
+}
+
+// restoreSnapshot verifies the given snapshot and restores it using the given client
+func restoreSnapshot(ctx context.Context, client *vault.VaultClient, snapshot io.ReadSeeker, force bool) error {
+	if _, err := snapshot.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	meta, err := raft.VerifySnapshot(snapshot)
+	if err != nil {
+		return err
+	}
+
+	if _, err := snapshot.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	logging.Info("Restoring snapshot", "id", meta.ID, "index", meta.Index, "term", meta.Term, "force", force)
+	if err := client.RestoreSnapshot(ctx, snapshot, force); err != nil {
+		return err
+	}
+
+	logging.Info("Successfully restored snapshot", "id", meta.ID)
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/storage"
+
+	"github.com/urfave/cli/v2"
+)
+
+const optionStorage = "storage"
+
+var storageFlag = &cli.StringFlag{
+	Name:    optionStorage,
+	Aliases: []string{"s"},
+	Usage:   "use the storage specified by `NAME`, e.g. aws or local-2; required if more than one storage is configured",
+}
+
+// createStorageController creates the controller of the storage with the given name.
+// If name is empty, the controller of the only configured storage is created
+func createStorageController(ctx context.Context, storages storage.StoragesConfig, name string) (storage.StorageController, error) {
+	factories := storages.Factories()
+	names := slices.Sorted(maps.Keys(factories))
+
+	if name == "" {
+		if len(names) != 1 {
+			return nil, fmt.Errorf("multiple storages configured, please specify one of %s via --%s", strings.Join(names, ", "), optionStorage)
+		}
+		name = names[0]
+	}
+
+	factory, found := factories[name]
+	if !found {
+		return nil, fmt.Errorf("storage %s is not configured, configured storages are %s", name, strings.Join(names, ", "))
+	}
+
+	return factory.CreateController(ctx)
+}
+
+// selectSnapshot returns the snapshot with the given name or the latest snapshot if name is empty.
+// The size of the snapshot is only known if the latest snapshot is selected
+func selectSnapshot(ctx context.Context, controller storage.StorageController, name string, defaults storage.StorageConfigDefaults) (storage.SnapshotInfo, error) {
+	if name != "" {
+		return storage.SnapshotInfo{Name: name}, nil
+	}
+
+	snapshots, err := controller.ListSnapshots(ctx, defaults)
+	if err != nil {
+		return storage.SnapshotInfo{}, err
+	}
+
+	if len(snapshots) < 1 {
+		return storage.SnapshotInfo{}, errors.New("storage does not contain any snapshots")
+	}
+
+	return snapshots[0], nil
+}
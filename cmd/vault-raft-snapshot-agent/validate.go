@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent"
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/vault"
+
+	"github.com/urfave/cli/v2"
+)
+
+const optionCheckConnectivity = "check-connectivity"
+
+var validateCommand = &cli.Command{
+	Name:  "validate",
+	Usage: "validates the configuration without taking a snapshot",
+	Description: "reads and validates the configuration;\n" +
+		"with --check-connectivity additionally logs into vault, detects the leader-node and lists the snapshots of all configured storages",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  optionCheckConnectivity,
+			Usage: "check that vault and all configured storages are accessible",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() > 0 {
+			return cli.ShowSubcommandHelp(ctx)
+		}
+
+		report := newValidationReport(os.Stdout)
+		defer report.flush()
+
+		config, err := agent.ReadConfig(agentOptions)
+		report.add("configuration", "valid", err)
+		if err != nil || !ctx.Bool(optionCheckConnectivity) {
+			return report.result()
+		}
+
+		checkVault(ctx.Context, report, config.Vault)
+		checkStorages(ctx.Context, report, config.Snapshots)
+
+		return report.result()
+	},
+}
+
+func checkVault(ctx context.Context, report *validationReport, config vault.VaultClientConfig) {
+	client, err := vault.CreateClient(config)
+	if err != nil {
+		report.add("vault", "", err)
+		return
+	}
+	defer closeClient(client)
+
+	leader, err := client.ConnectToLeader(ctx)
+	report.add("vault", fmt.Sprintf("authenticated with leader %s", leader), err)
+}
+
+func checkStorages(ctx context.Context, report *validationReport, config agent.SnapshotsConfig) {
+	factories := config.Storages.Factories()
+	for _, name := range slices.Sorted(maps.Keys(factories)) {
+		component := "storage " + name
+
+		controller, err := factories[name].CreateController(ctx)
+		if err != nil {
+			report.add(component, "", err)
+			continue
+		}
+
+		snapshots, err := controller.ListSnapshots(ctx, config.StorageConfigDefaults)
+		_ = controller.Close()
+		report.add(component, fmt.Sprintf("%s contains %d snapshots", factories[name].Destination(), len(snapshots)), err)
+	}
+}
+
+// validationReport prints a pass/fail line for each validated component
+type validationReport struct {
+	table  *tabwriter.Writer
+	failed bool
+}
+
+func newValidationReport(w io.Writer) *validationReport {
+	return &validationReport{table: tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)}
+}
+
+func (r *validationReport) add(component string, message string, err error) {
+	if err != nil {
+		r.failed = true
+		_, _ = fmt.Fprintf(r.table, "FAIL\t%s\t%s\n", component, err)
+	} else {
+		_, _ = fmt.Fprintf(r.table, "PASS\t%s\t%s\n", component, message)
+	}
+}
+
+func (r *validationReport) flush() {
+	_ = r.table.Flush()
+}
+
+func (r *validationReport) result() error {
+	if r.failed {
+		return errors.New("validation failed")
+	}
+	return nil
+}
@@ -8,6 +8,7 @@ require (
 	github.com/fsnotify/fsnotify v1.7.0
 	github.com/go-playground/validator/v10 v10.22.0
 	github.com/mitchellh/mapstructure v1.5.0
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/spf13/cast v1.6.0
 	github.com/spf13/viper v1.19.0
 	github.com/urfave/cli/v2 v2.27.3
@@ -37,6 +38,12 @@ require github.com/ncw/swift/v2 v2.0.2
 // S3-Storage
 require github.com/minio/minio-go/v7 v7.0.74
 
+// SFTP-Storage
+require github.com/pkg/sftp v1.13.6
+
+// WebDAV-Storage
+require golang.org/x/net v0.38.0
+
 // Vault
 require (
 	github.com/hashicorp/vault/api v1.14.0
@@ -52,15 +59,21 @@ require (
 // Metrics
 require github.com/prometheus/client_golang v1.20.5
 
+// Encryption
+require golang.org/x/crypto v0.36.0
+
+// Compression
+require (
+	github.com/klauspost/compress v1.17.9
+	github.com/ulikunitz/xz v0.5.12
+)
+
 // helpers
 require (
 	github.com/thoas/go-funk v0.9.3
 	go.uber.org/multierr v1.11.0
 )
 
-// ensure up-to-date versions (because of known vulnerabilities etc.)
-require golang.org/x/crypto v0.36.0 // indirect
-
 // testing
 require github.com/stretchr/testify v1.10.0
 
@@ -121,8 +134,8 @@ require (
 	github.com/hashicorp/go-uuid v1.0.3 // indirect
 	github.com/hashicorp/hcl v1.0.1-vault-5 // indirect
 	github.com/jmespath/go-jmespath v0.4.0 // indirect
-	github.com/klauspost/compress v1.17.9 // indirect
 	github.com/klauspost/cpuid/v2 v2.2.8 // indirect
+	github.com/kr/fs v0.1.0 // indirect
 	github.com/kylelemons/godebug v1.1.0 // indirect
 	github.com/leodido/go-urn v1.4.0 // indirect
 	github.com/magiconair/properties v1.8.7 // indirect
@@ -154,7 +167,6 @@ require (
 	go.opentelemetry.io/otel/metric v1.28.0 // indirect
 	go.opentelemetry.io/otel/trace v1.28.0 // indirect
 	golang.org/x/exp v0.0.0-20240719175910-8a7402abbf56 // indirect
-	golang.org/x/net v0.38.0 // indirect
 	golang.org/x/oauth2 v0.27.0 // indirect
 	golang.org/x/sync v0.12.0 // indirect
 	golang.org/x/sys v0.31.0 // indirect
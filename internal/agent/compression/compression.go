@@ -0,0 +1,133 @@
+package compression
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/config"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// CompressionConfig configures the compression of snapshots before they are uploaded to a storage
+type CompressionConfig struct {
+	Algorithm string `default:"zstd" validate:"oneof=gzip zstd xz"`
+	Level     int    `validate:"gte=0,compressionlevel"`
+	Suffix    string
+}
+
+const (
+	AlgorithmGzip = "gzip"
+	AlgorithmZstd = "zstd"
+	AlgorithmXz   = "xz"
+)
+
+// maxLevels contains the highest compression-level supported by each algorithm; xz does not support levels
+var maxLevels = map[string]int{
+	AlgorithmGzip: gzip.BestCompression,
+	AlgorithmZstd: 22,
+	AlgorithmXz:   0,
+}
+
+func init() {
+	config.RegisterValidation("compressionlevel", validateLevel)
+}
+
+// validateLevel validates that the level is supported by the algorithm of the CompressionConfig containing it
+func validateLevel(field validator.FieldLevel) bool {
+	c, ok := field.Parent().Interface().(CompressionConfig)
+	if !ok {
+		return false
+	}
+
+	maxLevel, ok := maxLevels[c.Algorithm]
+	return ok && field.Field().Int() <= int64(maxLevel)
+}
+
+// Algorithms contains all supported compression-algorithms
+var Algorithms = []string{AlgorithmGzip, AlgorithmZstd, AlgorithmXz}
+
+var suffixes = map[string]string{
+	AlgorithmGzip: ".gz",
+	AlgorithmZstd: ".zst",
+	AlgorithmXz:   ".xz",
+}
+
+// NameSuffix returns the configured Suffix or - if none is configured - the default suffix of the algorithm
+func (c CompressionConfig) NameSuffix() string {
+	if c.Suffix != "" {
+		return c.Suffix
+	}
+	return suffixes[c.Algorithm]
+}
+
+// Compress compresses the data read from src with the configured algorithm and level and writes it to dst.
+// A Level of 0 selects the default level of the algorithm
+func (c CompressionConfig) Compress(dst io.Writer, src io.Reader) error {
+	writer, err := c.newWriter(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(writer, src); err != nil {
+		_ = writer.Close()
+		return err
+	}
+
+	return writer.Close()
+}
+
+// Decompress decompresses the data read from src with the configured algorithm and writes it to dst
+func (c CompressionConfig) Decompress(dst io.Writer, src io.Reader) error {
+	reader, err := c.newReader(src)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	_, err = io.Copy(dst, reader)
+	return err
+}
+
+func (c CompressionConfig) newWriter(dst io.Writer) (io.WriteCloser, error) {
+	switch c.Algorithm {
+	case AlgorithmGzip:
+		if c.Level == 0 {
+			return gzip.NewWriter(dst), nil
+		}
+		return gzip.NewWriterLevel(dst, c.Level)
+	case AlgorithmZstd:
+		if c.Level == 0 {
+			return zstd.NewWriter(dst)
+		}
+		return zstd.NewWriter(dst, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(c.Level)))
+	case AlgorithmXz:
+		return xz.NewWriter(dst)
+	default:
+		return nil, fmt.Errorf("unsupported compression-algorithm %s", c.Algorithm)
+	}
+}
+
+func (c CompressionConfig) newReader(src io.Reader) (io.ReadCloser, error) {
+	switch c.Algorithm {
+	case AlgorithmGzip:
+		return gzip.NewReader(src)
+	case AlgorithmZstd:
+		reader, err := zstd.NewReader(src)
+		if err != nil {
+			return nil, err
+		}
+		return reader.IOReadCloser(), nil
+	case AlgorithmXz:
+		reader, err := xz.NewReader(src)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(reader), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression-algorithm %s", c.Algorithm)
+	}
+}
@@ -0,0 +1,77 @@
+package compression
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressDecompressRoundTrip(t *testing.T) {
+	data := strings.Repeat("vault-raft-snapshot-agent", 1000)
+
+	for _, config := range []CompressionConfig{
+		{Algorithm: AlgorithmGzip},
+		{Algorithm: AlgorithmGzip, Level: 9},
+		{Algorithm: AlgorithmZstd},
+		{Algorithm: AlgorithmZstd, Level: 19},
+		{Algorithm: AlgorithmXz},
+	} {
+		compressed := &bytes.Buffer{}
+		err := config.Compress(compressed, strings.NewReader(data))
+		assert.NoError(t, err, "Compress failed unexpectedly for %v", config)
+		assert.Less(t, compressed.Len(), len(data))
+
+		decompressed := &bytes.Buffer{}
+		err = config.Decompress(decompressed, compressed)
+		assert.NoError(t, err, "Decompress failed unexpectedly for %v", config)
+		assert.Equal(t, data, decompressed.String())
+	}
+}
+
+func TestCompressFailsForInvalidLevel(t *testing.T) {
+	err := CompressionConfig{Algorithm: AlgorithmGzip, Level: 42}.Compress(&bytes.Buffer{}, strings.NewReader("test"))
+	assert.Error(t, err)
+}
+
+func TestValidatesLevelOfAlgorithm(t *testing.T) {
+	validate := validator.New()
+	assert.NoError(t, validate.RegisterValidation("compressionlevel", validateLevel))
+
+	for _, tc := range []struct {
+		config CompressionConfig
+		valid  bool
+	}{
+		{CompressionConfig{Algorithm: AlgorithmGzip}, true},
+		{CompressionConfig{Algorithm: AlgorithmGzip, Level: 9}, true},
+		{CompressionConfig{Algorithm: AlgorithmGzip, Level: 10}, false},
+		{CompressionConfig{Algorithm: AlgorithmZstd, Level: 22}, true},
+		{CompressionConfig{Algorithm: AlgorithmZstd, Level: 23}, false},
+		{CompressionConfig{Algorithm: AlgorithmXz}, true},
+		{CompressionConfig{Algorithm: AlgorithmXz, Level: 1}, false},
+	} {
+		// compression-configs are referenced by pointers in the storage-configurations
+		err := validate.Struct(struct{ Compression *CompressionConfig }{&tc.config})
+		if tc.valid {
+			assert.NoError(t, err, "validation failed unexpectedly for %v", tc.config)
+		} else {
+			assert.Error(t, err, "validation should fail for %v", tc.config)
+		}
+	}
+}
+
+func TestDecompressFailsForUncompressedData(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmGzip, AlgorithmZstd, AlgorithmXz} {
+		err := CompressionConfig{Algorithm: algorithm}.Decompress(&bytes.Buffer{}, strings.NewReader("test"))
+		assert.Error(t, err, "Decompress should fail for uncompressed data with %s", algorithm)
+	}
+}
+
+func TestNameSuffixDefaultsToSuffixOfAlgorithm(t *testing.T) {
+	assert.Equal(t, ".gz", CompressionConfig{Algorithm: AlgorithmGzip}.NameSuffix())
+	assert.Equal(t, ".zst", CompressionConfig{Algorithm: AlgorithmZstd}.NameSuffix())
+	assert.Equal(t, ".xz", CompressionConfig{Algorithm: AlgorithmXz}.NameSuffix())
+	assert.Equal(t, ".test", CompressionConfig{Algorithm: AlgorithmXz, Suffix: ".test"}.NameSuffix())
+}
@@ -12,10 +12,22 @@ import (
 	"github.com/fsnotify/fsnotify"
 	"github.com/go-playground/validator/v10"
 	"github.com/mitchellh/mapstructure"
+	"github.com/robfig/cron/v3"
 	"github.com/spf13/cast"
 	"github.com/spf13/viper"
 )
 
+// validations contains the custom validations used in addition to the built-in validations of the validator
+var validations = map[string]validator.Func{
+	"cron": validateCron,
+}
+
+// RegisterValidation registers a custom validation for the given tag which is applied when configurations are unmarshalled.
+// It must be called before configurations are read, e.g. in the init-function of the package defining the configuration
+func RegisterValidation(tag string, fn validator.Func) {
+	validations[tag] = fn
+}
+
 // a rattlesnake is a viper adapted to our needs ;-)
 type rattlesnake struct {
 	v *viper.Viper
@@ -86,6 +98,11 @@ func (r rattlesnake) Unmarshal(config interface{}) error {
 
 	validate := validator.New()
 	validate.RegisterCustomTypeFunc(validateSecret, secret.Zero)
+	for tag, fn := range validations {
+		if err := validate.RegisterValidation(tag, fn); err != nil {
+			return err
+		}
+	}
 	if err := validate.Struct(config); err != nil {
 		return err
 	}
@@ -119,6 +136,13 @@ func validateSecret(field reflect.Value) interface{} {
 	return v
 }
 
+// validateCron replaces the built-in cron-validation of the validator
+// as it does not support timezones and names of months and weekdays
+func validateCron(field validator.FieldLevel) bool {
+	_, err := cron.ParseStandard(field.Field().String())
+	return err == nil
+}
+
 // implements automatic unmarshalling from environment variables
 // see https://github.com/spf13/viper/pull/1429
 // can be removed if that pr is merged
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/test"
+	"github.com/go-playground/validator/v10"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -70,6 +71,45 @@ func TestUnmarshalValidatesSecrets(t *testing.T) {
 	assert.Error(t, err, "Unmarshal should fail on validation error")
 }
 
+func TestUnmarshalValidatesCronExpressions(t *testing.T) {
+	rattlesnake := newRattlesnake("test", "TEST")
+
+	config := struct {
+		Schedule string `validate:"cron"`
+	}{
+		Schedule: "CRON_TZ=Europe/Berlin 0 2,14 * * MON-FRI",
+	}
+
+	err := rattlesnake.Unmarshal(&config)
+	assert.NoError(t, err, "Unmarshal failed unexpectedly")
+
+	config.Schedule = "0 25 * * *"
+	err = rattlesnake.Unmarshal(&config)
+	assert.Error(t, err, "Unmarshal should fail on validation error")
+}
+
+func TestUnmarshalAppliesRegisteredValidations(t *testing.T) {
+	RegisterValidation("test", func(field validator.FieldLevel) bool {
+		return field.Field().String() == "valid"
+	})
+	t.Cleanup(func() { delete(validations, "test") })
+
+	rattlesnake := newRattlesnake("test", "TEST")
+
+	config := struct {
+		Value string `validate:"test"`
+	}{
+		Value: "valid",
+	}
+
+	err := rattlesnake.Unmarshal(&config)
+	assert.NoError(t, err, "Unmarshal failed unexpectedly")
+
+	config.Value = "invalid"
+	err = rattlesnake.Unmarshal(&config)
+	assert.Error(t, err, "Unmarshal should fail on validation error")
+}
+
 func TestOnConfigChangeRunsHandler(t *testing.T) {
 	rattlesnake := newRattlesnake("test", "TEST")
 
@@ -49,6 +49,14 @@ func resolveSecretFilePaths(value reflect.Value, baseDir string) error {
 			}
 		}
 
+		if f.Kind() == reflect.Slice && f.Type().Elem().Kind() == reflect.Struct {
+			for j := 0; j < f.Len(); j++ {
+				if err := resolveSecretFilePaths(f.Index(j), baseDir); err != nil {
+					return err
+				}
+			}
+		}
+
 		if f.Type() != secretType || !strings.HasPrefix(f.String(), filePrefix) {
 			continue
 		}
@@ -45,3 +45,21 @@ func TestResolvesRecursively(t *testing.T) {
 	assert.Equal(t, FromFile(filepath.Clean(fmt.Sprintf("%s/inner", dir))), outer.Inner.File)
 	assert.Equal(t, FromFile(filepath.Clean(fmt.Sprintf("%s/innerPtr", dir))), innerPtr.File)
 }
+
+func TestResolvesInSlices(t *testing.T) {
+	type inner struct {
+		File Secret
+	}
+
+	var outer struct {
+		Inner []inner
+	}
+	outer.Inner = []inner{{FromFile("./inner1")}, {FromFile("./inner2")}}
+
+	dir := t.TempDir()
+	err := ResolveFilePaths(&outer, dir)
+	assert.NoError(t, err, "ResolveSecretFilePath failed unexpectedly")
+
+	assert.Equal(t, FromFile(filepath.Clean(fmt.Sprintf("%s/inner1", dir))), outer.Inner[0].File)
+	assert.Equal(t, FromFile(filepath.Clean(fmt.Sprintf("%s/inner2", dir))), outer.Inner[1].File)
+}
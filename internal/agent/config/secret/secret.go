@@ -45,6 +45,15 @@ func (s Secret) IsZero() bool {
 	return s == Zero
 }
 
+// FilePath returns the path of the file referenced by the secret and whether the secret references a file at all
+func (s Secret) FilePath() (string, bool) {
+	v := string(s)
+	if !strings.HasPrefix(v, filePrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(v, filePrefix), true
+}
+
 func (s Secret) Resolve(required bool) (string, error) {
 	v := string(s)
 
@@ -104,3 +104,15 @@ func TestWithAbsoluteFileReturnsForPlainSecret(t *testing.T) {
 	secret := FromString("test")
 	assert.Equal(t, secret, secret.WithAbsoluteFilePath(t.TempDir()))
 }
+
+func TestFilePathReturnsPathOfFileSecret(t *testing.T) {
+	path, ok := FromFile("/test/file").FilePath()
+	assert.True(t, ok)
+	assert.Equal(t, "/test/file", path)
+
+	_, ok = FromEnv("TEST").FilePath()
+	assert.False(t, ok)
+
+	_, ok = FromString("plain").FilePath()
+	assert.False(t, ok)
+}
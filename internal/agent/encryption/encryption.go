@@ -0,0 +1,206 @@
+package encryption
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/config/secret"
+	"golang.org/x/crypto/hkdf"
+)
+
+// EncryptionConfig configures the encryption of snapshots before they are uploaded to a storage
+type EncryptionConfig struct {
+	Key    secret.Secret `validate:"required"`
+	Suffix string        `default:".enc"`
+}
+
+// DefaultSuffix is the suffix appended to the names of encrypted snapshots if no other Suffix is configured
+const DefaultSuffix = ".enc"
+
+const (
+	keySize   = 32
+	saltSize  = 32
+	chunkSize = 64 * 1024
+	// nonces consist of a 11-byte big-endian chunk-counter and a flag marking the last chunk
+	nonceCounterSize = 11
+	lastChunkFlag    = 0x01
+)
+
+var (
+	magic = []byte("VRSAENC\x01")
+	info  = []byte("vault-raft-snapshot-agent snapshot-encryption")
+
+	errInvalidFormat = errors.New("data is not an encrypted snapshot")
+	errTruncated     = errors.New("encrypted snapshot is truncated")
+)
+
+// EncryptedSize returns the size of the encrypted data for a snapshot of the given size
+func EncryptedSize(size int64) int64 {
+	if size < 0 {
+		return size
+	}
+
+	chunks := size / chunkSize
+	if size%chunkSize != 0 || size == 0 {
+		chunks++
+	}
+
+	return int64(len(magic)) + saltSize + size + chunks*aes.BlockSize
+}
+
+// Encrypt encrypts the data read from src with AES-256-GCM and writes the result to dst.
+// The data is encrypted in chunks so that arbitrary large snapshots can be streamed;
+// every encrypted snapshot uses its own key derived from the configured key and a random salt.
+func (c EncryptionConfig) Encrypt(dst io.Writer, src io.Reader) error {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("could not create salt: %w", err)
+	}
+
+	aead, err := c.createCipher(salt)
+	if err != nil {
+		return err
+	}
+
+	if _, err := dst.Write(append(bytes.Clone(magic), salt...)); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReaderSize(src, chunkSize)
+	buf := make([]byte, chunkSize, chunkSize+aead.Overhead())
+
+	for counter := uint64(0); ; counter++ {
+		n, err := io.ReadFull(reader, buf[:chunkSize])
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return err
+		}
+
+		last := n < chunkSize
+		if !last {
+			if _, err := reader.Peek(1); errors.Is(err, io.EOF) {
+				last = true
+			} else if err != nil {
+				return err
+			}
+		}
+
+		if _, err := dst.Write(aead.Seal(buf[:0], nonce(counter, last), buf[:n], nil)); err != nil {
+			return err
+		}
+
+		if last {
+			return nil
+		}
+	}
+}
+
+// Decrypt decrypts the data read from src that was encrypted by Encrypt and writes the result to dst.
+// Decrypt fails if the data was not encrypted with the configured key, has been modified or is truncated.
+func (c EncryptionConfig) Decrypt(dst io.Writer, src io.Reader) error {
+	header := make([]byte, len(magic)+saltSize)
+	if _, err := io.ReadFull(src, header); err != nil {
+		return errInvalidFormat
+	}
+
+	if !bytes.Equal(header[:len(magic)], magic) {
+		return errInvalidFormat
+	}
+
+	aead, err := c.createCipher(header[len(magic):])
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReaderSize(src, chunkSize+aead.Overhead())
+	buf := make([]byte, chunkSize+aead.Overhead())
+
+	for counter := uint64(0); ; counter++ {
+		n, err := io.ReadFull(reader, buf)
+		if errors.Is(err, io.EOF) {
+			return errTruncated
+		}
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return err
+		}
+
+		last := n < len(buf)
+		if !last {
+			if _, err := reader.Peek(1); errors.Is(err, io.EOF) {
+				last = true
+			} else if err != nil {
+				return err
+			}
+		}
+
+		plain, err := aead.Open(buf[:0], nonce(counter, last), buf[:n], nil)
+		if err != nil {
+			if !last {
+				return err
+			}
+			return errTruncated
+		}
+
+		if _, err := dst.Write(plain); err != nil {
+			return err
+		}
+
+		if last {
+			return nil
+		}
+	}
+}
+
+func (c EncryptionConfig) createCipher(salt []byte) (cipher.AEAD, error) {
+	key, err := c.resolveKey()
+	if err != nil {
+		return nil, err
+	}
+
+	derivedKey := make([]byte, keySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, salt, info), derivedKey); err != nil {
+		return nil, fmt.Errorf("could not derive encryption-key: %w", err)
+	}
+
+	block, err := aes.NewCipher(derivedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func (c EncryptionConfig) resolveKey() ([]byte, error) {
+	encoded, err := c.Key.Resolve(true)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace([]byte(encoded))))
+	if err != nil {
+		return nil, fmt.Errorf("encryption-key is not base64-encoded: %w", err)
+	}
+
+	if len(key) != keySize {
+		return nil, fmt.Errorf("encryption-key must be %d bytes long", keySize)
+	}
+
+	return key, nil
+}
+
+func nonce(counter uint64, last bool) []byte {
+	n := make([]byte, nonceCounterSize+1)
+	binary.BigEndian.PutUint64(n[nonceCounterSize-8:nonceCounterSize], counter)
+	if last {
+		n[nonceCounterSize] = lastChunkFlag
+	}
+	return n
+}
@@ -0,0 +1,79 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/config/secret"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+	config := EncryptionConfig{Key: createKey(t)}
+
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 17} {
+		data := make([]byte, size)
+		_, _ = rand.Read(data)
+
+		encrypted := &bytes.Buffer{}
+		err := config.Encrypt(encrypted, bytes.NewReader(data))
+		assert.NoError(t, err, "Encrypt failed unexpectedly for size %d", size)
+		assert.Equal(t, EncryptedSize(int64(size)), int64(encrypted.Len()))
+		// short plaintexts may occur in the ciphertext by chance
+		if size >= 16 {
+			assert.NotContains(t, encrypted.String(), string(data))
+		}
+
+		decrypted := &bytes.Buffer{}
+		err = config.Decrypt(decrypted, bytes.NewReader(encrypted.Bytes()))
+		assert.NoError(t, err, "Decrypt failed unexpectedly for size %d", size)
+		assert.Equal(t, string(data), decrypted.String())
+	}
+}
+
+func TestDecryptFailsWithWrongKey(t *testing.T) {
+	encrypted := &bytes.Buffer{}
+	err := EncryptionConfig{Key: createKey(t)}.Encrypt(encrypted, bytes.NewReader([]byte("test")))
+	assert.NoError(t, err, "Encrypt failed unexpectedly")
+
+	err = EncryptionConfig{Key: createKey(t)}.Decrypt(&bytes.Buffer{}, encrypted)
+	assert.Error(t, err)
+}
+
+func TestDecryptFailsIfTruncated(t *testing.T) {
+	config := EncryptionConfig{Key: createKey(t)}
+	data := make([]byte, 2*chunkSize)
+
+	encrypted := &bytes.Buffer{}
+	err := config.Encrypt(encrypted, bytes.NewReader(data))
+	assert.NoError(t, err, "Encrypt failed unexpectedly")
+
+	truncated := encrypted.Bytes()[:len(magic)+saltSize+chunkSize+16]
+	err = config.Decrypt(&bytes.Buffer{}, bytes.NewReader(truncated))
+	assert.ErrorIs(t, err, errTruncated)
+}
+
+func TestDecryptFailsForUnencryptedData(t *testing.T) {
+	err := EncryptionConfig{Key: createKey(t)}.Decrypt(&bytes.Buffer{}, bytes.NewReader([]byte("test")))
+	assert.ErrorIs(t, err, errInvalidFormat)
+}
+
+func TestEncryptFailsForInvalidKey(t *testing.T) {
+	err := EncryptionConfig{Key: secret.FromString("invalid")}.Encrypt(&bytes.Buffer{}, bytes.NewReader([]byte("test")))
+	assert.Error(t, err)
+
+	err = EncryptionConfig{Key: secret.FromString(base64.StdEncoding.EncodeToString([]byte("short")))}.Encrypt(&bytes.Buffer{}, bytes.NewReader([]byte("test")))
+	assert.Error(t, err)
+}
+
+func createKey(t *testing.T) secret.Secret {
+	t.Helper()
+
+	key := make([]byte, keySize)
+	_, err := rand.Read(key)
+	assert.NoError(t, err, "could not create key")
+
+	return secret.FromString(base64.StdEncoding.EncodeToString(key))
+}
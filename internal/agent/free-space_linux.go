@@ -0,0 +1,12 @@
+package agent
+
+import "syscall"
+
+// freeSpace returns the number of bytes available to unprivileged users in the file-system containing the given directory
+func freeSpace(dir string) (int64, error) {
+	stat := syscall.Statfs_t{}
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
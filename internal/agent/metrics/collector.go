@@ -14,6 +14,7 @@ type Publisher interface {
 	PublishNextSnapshot(next time.Time)
 	PublishSuccess(timestamp time.Time, size int64)
 	PublishFailure(timestamp time.Time)
+	PublishRetry(destination string)
 	Shutdown() error
 	Start() error
 }
@@ -48,6 +49,13 @@ func (c *Collector) Collect(timestamp time.Time, size int64, next time.Time) {
 	}
 }
 
+// CollectRetry reports that a failed upload to the given destination is retried
+func (c *Collector) CollectRetry(destination string) {
+	for _, publisher := range c.publishers {
+		publisher.PublishRetry(destination)
+	}
+}
+
 func (c *Collector) Shutdown() error {
 	var errs []error
 	for _, publisher := range c.publishers {
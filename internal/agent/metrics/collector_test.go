@@ -139,6 +139,19 @@ func TestCollectCallsPublisherMethodsFoFailure(t *testing.T) {
 }
 
 
+func TestCollectRetryCallsPublisherMethods(t *testing.T) {
+	publisher1 := &PublisherStub{}
+	publisher2 := &PublisherStub{}
+
+	collector := &Collector{}
+	collector.AddPublisher(publisher1)
+	collector.AddPublisher(publisher2)
+
+	collector.CollectRetry("test")
+
+	assert.Equal(t, []string{"test"}, publisher1.retries, "publisher1 should report retry")
+	assert.Equal(t, []string{"test"}, publisher2.retries, "publisher2 should report retry")
+}
 
 type PublisherStub struct {
 	lastSnapshotTime time.Time
@@ -149,6 +162,7 @@ type PublisherStub struct {
 	shutdown         bool
 	startError       error
 	shutdownError    error
+	retries          []string
 }
 
 func (p *PublisherStub) Start() error {
@@ -175,3 +189,7 @@ func (p *PublisherStub) PublishFailure(timestamp time.Time) {
 	p.lastSnapshotTime = timestamp
 	p.success = false
 }
+
+func (p *PublisherStub) PublishRetry(destination string) {
+	p.retries = append(p.retries, destination)
+}
@@ -27,6 +27,7 @@ type prometheusPublisher struct {
 	lastSnapshotSuccess        prometheus.Gauge
 	nextSnapshotTime           prometheus.Gauge
 	lastSnapshotSize           prometheus.Gauge
+	uploadRetries              *prometheus.CounterVec
 }
 
 func createPrometheusPublisher(ctx context.Context, config *PrometheusPublisherConfig) *prometheusPublisher {
@@ -78,6 +79,13 @@ func newPrometheusPublisher(registry *prometheus.Registry, server *http.Server)
 				Help: "Size of the last snapshot in bytes",
 			},
 		),
+		uploadRetries: promauto.With(registry).NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "vrsa_upload_retries_total",
+				Help: "Number of retried uploads per destination",
+			},
+			[]string{"destination"},
+		),
 	}
 }
 
@@ -97,6 +105,10 @@ func (p *prometheusPublisher) PublishFailure(timestamp time.Time) {
 	p.lastSnapshotSuccess.Set(0.0)
 }
 
+func (p *prometheusPublisher) PublishRetry(destination string) {
+	p.uploadRetries.WithLabelValues(destination).Inc()
+}
+
 func (p *prometheusPublisher) Start() error {
 	go func() {
 		err := p.server.ListenAndServe()
@@ -87,6 +87,26 @@ vrsa_last_snapshot_success 0.0
 	}
 }
 
+func TestPublishRetry(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	publisher := newPrometheusPublisher(registry, nil)
+
+	publisher.PublishRetry("test")
+	publisher.PublishRetry("test")
+	publisher.PublishRetry("other")
+
+	expected := `# HELP vrsa_upload_retries_total Number of retried uploads per destination
+# TYPE vrsa_upload_retries_total counter
+vrsa_upload_retries_total{destination="other"} 1
+vrsa_upload_retries_total{destination="test"} 2
+`
+
+	err := testutil.CollectAndCompare(registry, strings.NewReader(expected), "vrsa_upload_retries_total")
+	if err != nil {
+		t.Errorf("%s", err.Error())
+	}
+}
+
 func TestServer(t *testing.T) {
 	port, err := GetFreePort()
 	assert.NoError(t, err, "should acquire free port")
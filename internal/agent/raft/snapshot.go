@@ -0,0 +1,143 @@
+package raft
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	metaFile      = "meta.json"
+	stateFile     = "state.bin"
+	checksumsFile = "SHA256SUMS"
+)
+
+// SnapshotMeta contains the metadata stored in the meta.json of a raft-snapshot
+type SnapshotMeta struct {
+	Version int
+	ID      string
+	Index   uint64
+	Term    uint64
+	Size    int64
+}
+
+// VerifySnapshot verifies that the given data is a complete raft-snapshot as created by vault.
+// A snapshot is a gzipped tar-archive that must contain the raft-metadata in meta.json,
+// the raft-state in state.bin and the checksums of these files in SHA256SUMS.
+// VerifySnapshot returns an error if the archive is truncated, any of these files is missing,
+// any checksum does not match or the metadata is invalid.
+func VerifySnapshot(snapshot io.Reader) (SnapshotMeta, error) {
+	gz, err := gzip.NewReader(snapshot)
+	if err != nil {
+		return SnapshotMeta{}, fmt.Errorf("snapshot is not gzipped: %w", err)
+	}
+
+	var (
+		checksums    = map[string]string{}
+		metaData     []byte
+		checksumData []byte
+		archive      = tar.NewReader(gz)
+	)
+
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return SnapshotMeta{}, fmt.Errorf("could not read snapshot-archive: %w", err)
+		}
+
+		hash := sha256.New()
+		content := &bytes.Buffer{}
+		writer := io.Writer(hash)
+		if header.Name == metaFile || header.Name == checksumsFile {
+			writer = io.MultiWriter(hash, content)
+		}
+
+		if _, err := io.Copy(writer, archive); err != nil {
+			return SnapshotMeta{}, fmt.Errorf("could not read %s from snapshot-archive: %w", header.Name, err)
+		}
+
+		checksums[header.Name] = hex.EncodeToString(hash.Sum(nil))
+		switch header.Name {
+		case metaFile:
+			metaData = content.Bytes()
+		case checksumsFile:
+			checksumData = content.Bytes()
+		}
+	}
+
+	// reading the remaining data ensures that the gzip-checksum is verified
+	if _, err := io.Copy(io.Discard, gz); err != nil {
+		return SnapshotMeta{}, fmt.Errorf("could not read snapshot-archive: %w", err)
+	}
+
+	if checksumData == nil {
+		return SnapshotMeta{}, fmt.Errorf("snapshot-archive does not contain %s", checksumsFile)
+	}
+
+	if err := verifyChecksums(checksumData, checksums); err != nil {
+		return SnapshotMeta{}, err
+	}
+
+	meta := SnapshotMeta{}
+	if err := json.Unmarshal(metaData, &meta); err != nil {
+		return SnapshotMeta{}, fmt.Errorf("invalid %s in snapshot-archive: %w", metaFile, err)
+	}
+
+	if meta.Index == 0 || meta.Term == 0 {
+		return SnapshotMeta{}, fmt.Errorf("invalid %s in snapshot-archive: missing raft index or term", metaFile)
+	}
+
+	return meta, nil
+}
+
+func verifyChecksums(checksumData []byte, checksums map[string]string) error {
+	verified := map[string]bool{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(checksumData))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		expected, file, found := strings.Cut(line, " ")
+		if !found {
+			return fmt.Errorf("invalid line in %s: %s", checksumsFile, line)
+		}
+
+		file = strings.TrimSpace(file)
+		actual, present := checksums[file]
+		if !present {
+			return fmt.Errorf("snapshot-archive does not contain %s", file)
+		}
+
+		if !strings.EqualFold(expected, actual) {
+			return fmt.Errorf("checksum of %s in snapshot-archive does not match", file)
+		}
+
+		verified[file] = true
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	for _, file := range []string{metaFile, stateFile} {
+		if !verified[file] {
+			return fmt.Errorf("snapshot-archive does not contain verified %s", file)
+		}
+	}
+
+	return nil
+}
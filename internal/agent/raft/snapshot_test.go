@@ -0,0 +1,90 @@
+package raft
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifySnapshotReturnsMeta(t *testing.T) {
+	snapshot := test.RaftSnapshot(t, "test")
+
+	meta, err := VerifySnapshot(bytes.NewReader(snapshot))
+
+	assert.NoError(t, err, "VerifySnapshot failed unexpectedly")
+	assert.Equal(t, SnapshotMeta{Version: 1, ID: "2-10-1700000000000", Index: 10, Term: 2, Size: 4}, meta)
+}
+
+func TestVerifySnapshotFailsIfNotGzipped(t *testing.T) {
+	_, err := VerifySnapshot(bytes.NewReader([]byte("test")))
+	assert.Error(t, err)
+}
+
+func TestVerifySnapshotFailsIfTruncated(t *testing.T) {
+	snapshot := test.RaftSnapshot(t, "test")
+
+	_, err := VerifySnapshot(bytes.NewReader(snapshot[:len(snapshot)-10]))
+	assert.Error(t, err)
+}
+
+func TestVerifySnapshotFailsIfChecksumDoesNotMatch(t *testing.T) {
+	snapshot := createArchive(t, map[string]string{
+		"meta.json":  `{"Index":1,"Term":1}`,
+		"state.bin":  "test",
+		"SHA256SUMS": "ebcd646ab9a28104efd8e006956b018f031355cc03524be8fbcb72d85ebb5dfd  meta.json\n0000000000000000000000000000000000000000000000000000000000000000  state.bin\n",
+	})
+
+	_, err := VerifySnapshot(bytes.NewReader(snapshot))
+	assert.ErrorContains(t, err, "checksum")
+}
+
+func TestVerifySnapshotFailsIfFilesAreMissing(t *testing.T) {
+	snapshot := createArchive(t, map[string]string{
+		"state.bin": "test",
+	})
+
+	_, err := VerifySnapshot(bytes.NewReader(snapshot))
+	assert.ErrorContains(t, err, checksumsFile)
+
+	snapshot = createArchive(t, map[string]string{
+		"state.bin":  "test",
+		"SHA256SUMS": "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08  state.bin\n",
+	})
+
+	_, err = VerifySnapshot(bytes.NewReader(snapshot))
+	assert.ErrorContains(t, err, metaFile)
+}
+
+func TestVerifySnapshotFailsIfMetaIsInvalid(t *testing.T) {
+	snapshot := createArchive(t, map[string]string{
+		"meta.json":  `{}`,
+		"state.bin":  "test",
+		"SHA256SUMS": "44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a  meta.json\n9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08  state.bin\n",
+	})
+
+	_, err := VerifySnapshot(bytes.NewReader(snapshot))
+	assert.ErrorContains(t, err, metaFile)
+}
+
+func createArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	buffer := &bytes.Buffer{}
+	gz := gzip.NewWriter(buffer)
+	archive := tar.NewWriter(gz)
+
+	for name, content := range files {
+		assert.NoError(t, archive.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(content))}))
+		_, err := archive.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, archive.Close())
+	assert.NoError(t, gz.Close())
+
+	return buffer.Bytes()
+}
@@ -1,12 +1,16 @@
 package agent
 
 import (
+	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/compression"
 	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/config/secret"
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/encryption"
 	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/metrics"
 	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/test"
 
@@ -42,11 +46,21 @@ func TestReadCompleteConfig(t *testing.T) {
 			},
 			Insecure: true,
 			Timeout:  5 * time.Minute,
+			TLS: vault.VaultTLSConfig{
+				CACert:     secret.FromFile("/test/ca.pem"),
+				CAPath:     "/test/certs",
+				ClientCert: secret.FromFile("/test/client.pem"),
+				ClientKey:  secret.FromFile("/test/client-key.pem"),
+				ServerName: "vault.example.com",
+				MinVersion: "1.3",
+			},
+			Namespace: "test-namespace",
 			Auth: auth.VaultAuthConfig{
 				AppRole: &auth.AppRoleAuthConfig{
-					Path:     "test-approle-path",
-					RoleId:   "test-approle",
-					SecretId: "test-approle-secret",
+					Path:      "test-approle-path",
+					RoleId:    "test-approle",
+					SecretId:  "test-approle-secret",
+					Namespace: "test-approle-namespace",
 				},
 				AWS: &auth.AWSAuthConfig{
 					Path:             "test-aws-path",
@@ -60,11 +74,22 @@ func TestReadCompleteConfig(t *testing.T) {
 					Role:     "test-azure-role",
 					Resource: "test-resource",
 				},
+				Cert: &auth.CertAuthConfig{
+					Path:       "test-cert-path",
+					Role:       "test-cert-role",
+					ClientCert: "test-cert",
+					ClientKey:  "test-cert-key",
+				},
 				GCP: &auth.GCPAuthConfig{
 					Path:                "test-gcp-path",
 					Role:                "test-gcp-role",
 					ServiceAccountEmail: "test@example.com",
 				},
+				JWT: &auth.JWTAuthConfig{
+					Path:  "test-jwt-path",
+					Role:  "test-jwt-role",
+					Token: secret.FromFile(relativeTo(configFile, "./jwt")),
+				},
 				Kubernetes: &auth.KubernetesAuthConfig{
 					Role:     "test-kubernetes-role",
 					Path:     "test-kubernetes-path",
@@ -85,15 +110,41 @@ func TestReadCompleteConfig(t *testing.T) {
 		},
 		Snapshots: SnapshotsConfig{
 			StorageConfigDefaults: storage.StorageConfigDefaults{
-				Frequency:       time.Hour * 2,
-				Retain:          10,
+				Frequency: time.Hour * 2,
+				Schedule:  "CRON_TZ=UTC 0 2,14 * * *",
+				Retain:    10,
+				Retention: storage.RetentionConfig{
+					Hourly:  24,
+					Daily:   7,
+					Weekly:  4,
+					Monthly: 12,
+					Yearly:  2,
+				},
+				MaxAge:          time.Hour * 2160,
+				MaxTotalSize:    1073741824,
 				Timeout:         time.Minute * 2,
 				NamePrefix:      "test-",
 				NameSuffix:      ".test",
 				TimestampFormat: "2006-01-02",
+				Layout:          "2006/01",
+				Compression: &compression.CompressionConfig{
+					Algorithm: "gzip",
+					Level:     9,
+					Suffix:    ".test-gz",
+				},
+				Encryption: &encryption.EncryptionConfig{
+					Key:    "test-key",
+					Suffix: ".test-enc",
+				},
+				Retry: storage.RetryConfig{
+					MaxAttempts:    5,
+					InitialBackoff: time.Second * 10,
+					MaxBackoff:     time.Minute * 2,
+					Jitter:         0.5,
+				},
 			},
 			Storages: storage.StoragesConfig{
-				AWS: &storage.AWSStorageConfig{
+				AWS: []storage.AWSStorageConfig{{
 					AccessKeyId:             "test-key",
 					AccessKey:               "test-secret",
 					SessionToken:            "test-session",
@@ -103,8 +154,8 @@ func TestReadCompleteConfig(t *testing.T) {
 					KeyPrefix:               "test-prefix",
 					UseServerSideEncryption: true,
 					ForcePathStyle:          true,
-				},
-				Azure: &storage.AzureStorageConfig{
+				}},
+				Azure: []storage.AzureStorageConfig{{
 					StorageControllerConfig: storage.StorageControllerConfig{
 						Retain: test.PtrTo(0),
 					},
@@ -112,22 +163,33 @@ func TestReadCompleteConfig(t *testing.T) {
 					AccountKey:  "test-key",
 					Container:   "test-container",
 					CloudDomain: "blob.core.chinacloudapi.cn",
-				},
-				GCP: &storage.GCPStorageConfig{
+				}},
+				GCP: []storage.GCPStorageConfig{{
 					StorageControllerConfig: storage.StorageControllerConfig{
-						Retain: test.PtrTo(1),
+						Retain:    test.PtrTo(1),
+						Retention: &storage.RetentionConfig{Daily: 3},
 					},
 					Bucket: "test-bucket",
-				},
-				Local: &storage.LocalStorageConfig{
-					StorageControllerConfig: storage.StorageControllerConfig{
-						Retain: test.PtrTo(2),
+				}},
+				Local: []storage.LocalStorageConfig{
+					{
+						StorageControllerConfig: storage.StorageControllerConfig{
+							Retain:       test.PtrTo(2),
+							MaxTotalSize: 1048576,
+						},
+						Path: ".",
+					},
+					{
+						StorageControllerConfig: storage.StorageControllerConfig{
+							NamePrefix: "test-local-",
+						},
+						Path: "..",
 					},
-					Path: ".",
 				},
-				Swift: &storage.SwiftStorageConfig{
+				Swift: []storage.SwiftStorageConfig{{
 					StorageControllerConfig: storage.StorageControllerConfig{
-						Retain: test.PtrTo(3),
+						Retain:   test.PtrTo(3),
+						Schedule: "@daily",
 					},
 					Container: "test-container",
 					UserName:  "test-username",
@@ -136,8 +198,8 @@ func TestReadCompleteConfig(t *testing.T) {
 					Domain:    "https://user.com",
 					Region:    "test-region",
 					TenantId:  "test-tenant",
-				},
-				S3: &storage.S3StorageConfig{
+				}},
+				S3: []storage.S3StorageConfig{{
 					StorageControllerConfig: storage.StorageControllerConfig{
 						Retain: test.PtrTo(4),
 					},
@@ -149,7 +211,37 @@ func TestReadCompleteConfig(t *testing.T) {
 					Region:        "test-s3-region",
 					Insecure:      true,
 					SkipSSLVerify: true,
-				},
+				}},
+				SFTP: []storage.SFTPStorageConfig{{
+					StorageControllerConfig: storage.StorageControllerConfig{
+						Retain: test.PtrTo(5),
+					},
+					Host:                    "test-sftp-host",
+					Port:                    2222,
+					Path:                    "/test/path",
+					Username:                "test-sftp-user",
+					Password:                "test-sftp-password",
+					PrivateKey:              "test-sftp-key",
+					PrivateKeyPassphrase:    "test-sftp-passphrase",
+					SkipHostKeyVerification: true,
+				}},
+				WebDAV: []storage.WebDAVStorageConfig{{
+					StorageControllerConfig: storage.StorageControllerConfig{
+						Retain: test.PtrTo(6),
+					},
+					Url:         "https://test-webdav-host/test/collection",
+					Username:    "test-webdav-user",
+					Password:    "test-webdav-password",
+					BearerToken: "test-webdav-token",
+					CACert:      "test-webdav-ca",
+				}},
+				Concurrency: 3,
+			},
+			Buffer: BufferConfig{
+				Mode:         "memory",
+				TempDir:      "/test/tmp",
+				MemoryLimit:  1048576,
+				MinFreeSpace: 2147483648,
 			},
 		},
 		Metrics: metrics.CollectorConfig{
@@ -178,6 +270,7 @@ func TestReadConfigSetsDefaultValues(t *testing.T) {
 			},
 			Insecure: false,
 			Timeout:  time.Minute,
+			TLS:      vault.VaultTLSConfig{MinVersion: "1.2"},
 			Auth: auth.VaultAuthConfig{
 				Kubernetes: &auth.KubernetesAuthConfig{
 					Role:     "test-role",
@@ -194,11 +287,21 @@ func TestReadConfigSetsDefaultValues(t *testing.T) {
 				NamePrefix:      "raft-snapshot-",
 				NameSuffix:      ".snap",
 				TimestampFormat: "2006-01-02T15-04-05Z-0700",
+				Retry: storage.RetryConfig{
+					MaxAttempts:    3,
+					InitialBackoff: time.Second * 5,
+					MaxBackoff:     time.Minute,
+					Jitter:         0.1,
+				},
 			},
 			Storages: storage.StoragesConfig{
-				Local: &storage.LocalStorageConfig{
+				Local: []storage.LocalStorageConfig{{
 					Path: ".",
-				},
+				}},
+			},
+			Buffer: BufferConfig{
+				Mode:        "file",
+				MemoryLimit: 67108864,
 			},
 		},
 	}
@@ -210,3 +313,34 @@ func TestReadConfigSetsDefaultValues(t *testing.T) {
 	assert.NoError(t, err, "ReadConfig(%s) failed unexpectedly", configFile)
 	assert.Equal(t, expectedConfig, data)
 }
+
+func TestReadConfigRejectsUnsupportedCompressionLevel(t *testing.T) {
+	for algorithm, level := range map[string]int{"gzip": 10, "zstd": 23, "xz": 1} {
+		dir := t.TempDir()
+		configFile := filepath.Join(dir, "config.yaml")
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "jwt"), []byte("test"), 0600))
+		assert.NoError(t, os.WriteFile(configFile, []byte(fmt.Sprintf(`
+vault:
+  nodes:
+    urls:
+    - "http://127.0.0.1:8200"
+  auth:
+    kubernetes:
+      role: "test-role"
+      jwtToken: "file://./jwt"
+snapshots:
+  compression:
+    algorithm: %s
+    level: %d
+  storages:
+    local:
+      path: .
+`, algorithm, level)), 0600))
+
+		data := SnapshotAgentConfig{}
+		parser := config.NewParser[*SnapshotAgentConfig]("VRSA", "")
+		err := parser.ReadConfig(&data, configFile)
+
+		assert.Error(t, err, "ReadConfig should fail for level %d of %s", level, algorithm)
+	}
+}
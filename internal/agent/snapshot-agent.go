@@ -2,14 +2,15 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"io"
-	"os"
 	"sync"
 	"time"
 
 	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/config"
 	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/logging"
 	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/metrics"
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/raft"
 	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/storage"
 	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/vault"
 )
@@ -25,6 +26,7 @@ type SnapshotAgentConfig struct {
 type SnapshotsConfig struct {
 	storage.StorageConfigDefaults `mapstructure:",squash"`
 	Storages                      storage.StoragesConfig
+	Buffer                        BufferConfig
 }
 
 // SnapshotAgentOptions is a Parameter Object containing all parameters required by CreateSnapshotAgent
@@ -33,6 +35,7 @@ type SnapshotAgentOptions struct {
 	ConfigFileSearchPaths []string
 	ConfigFilePath        string
 	EnvPrefix             string
+	Version               string
 }
 
 // SnapshotAgent implements the taking of snapshots from vault and uploading them to the storages
@@ -40,20 +43,28 @@ type SnapshotAgent struct {
 	lock                  sync.Mutex
 	client                snapshotAgentVaultAPI
 	manager               snapshotManager
-	tempDir               string
+	buffer                BufferConfig
 	storageConfigDefaults storage.StorageConfigDefaults
 	lastSnapshotTime      time.Time
+	lastSnapshotSize      int64
 	snapshotTicker        *time.Ticker
 	metrics               *metrics.Collector
+	version               string
 }
 
 type snapshotAgentVaultAPI interface {
 	TakeSnapshot(ctx context.Context, writer io.Writer) error
+	ConnectedNode() string
+	VaultVersion(ctx context.Context) string
+	Close(ctx context.Context) error
 }
 
 type snapshotManager interface {
 	ScheduleSnapshot(ctx context.Context, lastSnapshot time.Time, defaults storage.StorageConfigDefaults) time.Time
-	UploadSnapshot(ctx context.Context, snapshot io.ReadSeeker, snapshotSize int64, timestamp time.Time, defaults storage.StorageConfigDefaults) time.Time
+	UploadSnapshot(ctx context.Context, snapshot io.ReaderAt, snapshotSize int64, timestamp time.Time, metadata storage.SnapshotMetadata, defaults storage.StorageConfigDefaults) (time.Time, error)
+	StreamSnapshot(ctx context.Context, snapshot io.Reader, timestamp time.Time, verify func(io.Reader) (storage.SnapshotMetadata, error), defaults storage.StorageConfigDefaults) (time.Time, int64, error)
+	ListSnapshots(ctx context.Context, defaults storage.StorageConfigDefaults) ([]storage.StoredSnapshot, error)
+	RemoveStaleData()
 }
 
 func (c SnapshotAgentConfig) HasStorages() bool {
@@ -61,12 +72,19 @@ func (c SnapshotAgentConfig) HasStorages() bool {
 }
 
 func (c SnapshotsConfig) HasStorages() bool {
-	return c.Storages.AWS != nil || c.Storages.Azure != nil || c.Storages.GCP != nil || c.Storages.Local != nil || c.Storages.Swift != nil || c.Storages.S3 != nil
+	return c.Storages.HasStorages()
+}
+
+// ReadConfig reads the agent-configuration without creating an agent
+func ReadConfig(options SnapshotAgentOptions) (SnapshotAgentConfig, error) {
+	data := SnapshotAgentConfig{}
+	err := newConfigParser(options).ReadConfig(&data, options.ConfigFilePath)
+	return data, err
 }
 
 func CreateSnapshotAgent(ctx context.Context, options SnapshotAgentOptions) (*SnapshotAgent, error) {
 	data := SnapshotAgentConfig{}
-	parser := config.NewParser[*SnapshotAgentConfig](options.EnvPrefix, options.ConfigFileName, options.ConfigFileSearchPaths...)
+	parser := newConfigParser(options)
 
 	if err := parser.ReadConfig(&data, options.ConfigFilePath); err != nil {
 		return nil, err
@@ -76,6 +94,10 @@ func CreateSnapshotAgent(ctx context.Context, options SnapshotAgentOptions) (*Sn
 	if err != nil {
 		return nil, err
 	}
+	agent.version = options.Version
+
+	// remove data left in the storages by uploads interrupted when the agent stopped the last time
+	agent.manager.RemoveStaleData()
 
 	parser.OnConfigChange(
 		&SnapshotAgentConfig{},
@@ -91,16 +113,19 @@ func CreateSnapshotAgent(ctx context.Context, options SnapshotAgentOptions) (*Sn
 	return agent, nil
 }
 
+func newConfigParser(options SnapshotAgentOptions) config.Parser[*SnapshotAgentConfig] {
+	return config.NewParser[*SnapshotAgentConfig](options.EnvPrefix, options.ConfigFileName, options.ConfigFileSearchPaths...)
+}
+
 func createSnapshotAgent(ctx context.Context, config SnapshotAgentConfig) (*SnapshotAgent, error) {
-	agent := newSnapshotAgent("")
+	agent := newSnapshotAgent()
 	err := agent.reconfigure(ctx, config)
 	return agent, err
 }
 
-func newSnapshotAgent(tempDir string) *SnapshotAgent {
+func newSnapshotAgent() *SnapshotAgent {
 	return &SnapshotAgent{
 		snapshotTicker: time.NewTicker(time.Hour),
-		tempDir:        tempDir,
 	}
 }
 
@@ -110,10 +135,14 @@ func (a *SnapshotAgent) reconfigure(ctx context.Context, config SnapshotAgentCon
 		return err
 	}
 
-	return a.update(ctx, client, storage.CreateManager(config.Snapshots.Storages), config.Snapshots.StorageConfigDefaults, metrics.CreateCollector(ctx, config.Metrics))
+	manager := storage.CreateManager(config.Snapshots.Storages)
+	collector := metrics.CreateCollector(ctx, config.Metrics)
+	manager.OnRetry(collector.CollectRetry)
+
+	return a.update(ctx, client, manager, config.Snapshots.StorageConfigDefaults, config.Snapshots.Buffer, collector)
 }
 
-func (a *SnapshotAgent) update(ctx context.Context, client snapshotAgentVaultAPI, manager snapshotManager, defaults storage.StorageConfigDefaults, metrics *metrics.Collector) error {
+func (a *SnapshotAgent) update(ctx context.Context, client snapshotAgentVaultAPI, manager snapshotManager, defaults storage.StorageConfigDefaults, buffer BufferConfig, metrics *metrics.Collector) error {
 	a.lock.Lock()
 	defer a.lock.Unlock()
 
@@ -123,8 +152,16 @@ func (a *SnapshotAgent) update(ctx context.Context, client snapshotAgentVaultAPI
 		}
 	}
 
+	// revoke the token of the replaced client as it is not used anymore
+	if a.client != nil && a.client != client {
+		if err := a.client.Close(ctx); err != nil {
+			logging.Warn("Could not revoke token of previous vault-client", "error", err)
+		}
+	}
+
 	a.client = client
 	a.manager = manager
+	a.buffer = buffer
 	a.storageConfigDefaults = defaults
 	a.metrics = metrics
 
@@ -140,28 +177,67 @@ func (a *SnapshotAgent) update(ctx context.Context, client snapshotAgentVaultAPI
 	return nil
 }
 
+// Close revokes the token the agent obtained from vault and stops collecting metrics
+func (a *SnapshotAgent) Close(ctx context.Context) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	var errs []error
+	if a.client != nil {
+		errs = append(errs, a.client.Close(ctx))
+	}
+	if a.metrics != nil {
+		errs = append(errs, a.metrics.Shutdown())
+	}
+	return errors.Join(errs...)
+}
+
+// TakeSnapshot takes a snapshot of vault and uploads it to the storages
+// It returns the ticker signaling when the next snapshot should be taken
 func (a *SnapshotAgent) TakeSnapshot(ctx context.Context) *time.Ticker {
 	a.lock.Lock()
 	defer a.lock.Unlock()
 
+	_ = a.takeSnapshot(ctx)
+	return a.snapshotTicker
+}
+
+// TakeSingleSnapshot takes a single snapshot of vault and uploads it to all storages.
+// It returns an error if the snapshot could not be taken or uploaded to any of the storages
+func (a *SnapshotAgent) TakeSingleSnapshot(ctx context.Context) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return a.takeSnapshot(ctx)
+}
+
+func (a *SnapshotAgent) takeSnapshot(ctx context.Context) error {
 	a.lastSnapshotTime = time.Now()
 
 	// ensure that we do not hammer on vault in case of errors
-	nextSnapshot := a.lastSnapshotTime.Add(a.storageConfigDefaults.Frequency)
+	nextSnapshot := a.storageConfigDefaults.NextSnapshot(a.lastSnapshotTime)
 	a.updateTicker(nextSnapshot)
 
-	snapshot, err := os.CreateTemp(a.tempDir, "snapshot")
+	if a.buffer.Mode == bufferModeStream {
+		return a.streamSnapshot(ctx, nextSnapshot)
+	}
+
+	if err := a.buffer.ensureFreeSpace(a.expectedSnapshotSize(ctx)); err != nil {
+		logging.Error("Not enough space to buffer snapshot", "nextSnapshot", nextSnapshot, "error", err)
+		a.metrics.Collect(a.lastSnapshotTime, -1, nextSnapshot)
+		return err
+	}
+
+	snapshot, err := newSnapshotBuffer(a.buffer.tempDir(), a.buffer.memoryLimit())
 	if err != nil {
-		logging.Warn("Could not create snapshot-temp-file", "nextSnapshot", nextSnapshot, "error", err)
+		logging.Warn("Could not create snapshot-buffer", "nextSnapshot", nextSnapshot, "error", err)
 		a.metrics.Collect(a.lastSnapshotTime, -1, nextSnapshot)
-		return a.snapshotTicker
+		return err
 	}
 
 	defer func() {
 		if err := snapshot.Close(); err != nil {
-			logging.Warn("Could not close snapshot-temp-file", "file", snapshot.Name(), "nextSnapshot", nextSnapshot, "error", err)
-		} else if err := os.Remove(snapshot.Name()); err != nil {
-			logging.Warn("Could not remove snapshot-temp-file %a: %a", "file", snapshot.Name(), "nextSnapshot", nextSnapshot, "error", err)
+			logging.Warn("Could not remove snapshot-buffer", "nextSnapshot", nextSnapshot, "error", err)
 		}
 	}()
 
@@ -169,24 +245,105 @@ func (a *SnapshotAgent) TakeSnapshot(ctx context.Context) *time.Ticker {
 	if err != nil {
 		logging.Error("Could not take snapshot of vault", "nextSnapshot", nextSnapshot, "error", err)
 		a.metrics.Collect(a.lastSnapshotTime, -1, nextSnapshot)
-		return a.snapshotTicker
+		return err
+	}
+
+	size := snapshot.Size()
+	if size < 1 {
+		logging.Warn("Ignoring empty snapshot", "nextSnapshot", nextSnapshot)
+		return errors.New("vault returned an empty snapshot")
 	}
 
-	info, err := snapshot.Stat()
+	metadata, err := a.verifySnapshot(ctx, io.NewSectionReader(snapshot, 0, size))
 	if err != nil {
-		logging.Error("Could not stat snapshot-temp-file", "file", snapshot.Name(), "nextSnapshot", nextSnapshot, "error", err)
+		logging.Error("Refusing to upload invalid snapshot", "nextSnapshot", nextSnapshot, "error", err)
+		a.metrics.Collect(a.lastSnapshotTime, -1, nextSnapshot)
+		return err
+	}
+
+	a.lastSnapshotSize = size
+
+	nextSnapshot, err = a.manager.UploadSnapshot(ctx, snapshot, size, a.lastSnapshotTime, metadata, a.storageConfigDefaults)
+	a.metrics.Collect(a.lastSnapshotTime, size, nextSnapshot)
+	a.updateTicker(nextSnapshot)
+	return err
+}
+
+// streamSnapshot uploads the snapshot to the storages while it is read from vault.
+// If the snapshot fails or is invalid, the given time for the next snapshot is reported
+func (a *SnapshotAgent) streamSnapshot(ctx context.Context, nextSnapshot time.Time) error {
+	reader, writer := io.Pipe()
+	defer reader.Close()
+
+	var snapshotErr, verificationErr error
+	go func() {
+		snapshotErr = a.client.TakeSnapshot(ctx, writer)
+		_ = writer.CloseWithError(snapshotErr)
+	}()
+
+	verify := func(snapshot io.Reader) (storage.SnapshotMetadata, error) {
+		metadata, err := a.verifySnapshot(ctx, snapshot)
+		verificationErr = err
+		return metadata, err
+	}
+
+	scheduledSnapshot, size, err := a.manager.StreamSnapshot(ctx, reader, a.lastSnapshotTime, verify, a.storageConfigDefaults)
+	if snapshotErr != nil || verificationErr != nil {
+		logging.Error("Could not stream valid snapshot of vault", "nextSnapshot", nextSnapshot, "error", err)
 		a.metrics.Collect(a.lastSnapshotTime, -1, nextSnapshot)
-		return a.snapshotTicker
+		return err
+	}
+
+	if err != nil {
+		// the streamed size does not describe a successfully uploaded snapshot
+		a.metrics.Collect(a.lastSnapshotTime, -1, scheduledSnapshot)
+	} else {
+		a.lastSnapshotSize = size
+		a.metrics.Collect(a.lastSnapshotTime, size, scheduledSnapshot)
+	}
+	a.updateTicker(scheduledSnapshot)
+	return err
+}
+
+// expectedSnapshotSize returns the size of the last snapshot taken by the agent.
+// Before the first snapshot, the size of the latest snapshot in the storages is used instead; as stored snapshots
+// may be compressed, this is only a lower bound of the snapshot's actual size
+func (a *SnapshotAgent) expectedSnapshotSize(ctx context.Context) int64 {
+	if a.lastSnapshotSize > 0 {
+		return a.lastSnapshotSize
+	}
+
+	// failures of single storages are ignored as the snapshots of the other storages are still listed
+	snapshots, err := a.manager.ListSnapshots(ctx, a.storageConfigDefaults)
+	if err != nil {
+		logging.Warn("Could not list all stored snapshots to determine the expected snapshot-size", "error", err)
+	}
+
+	var latest storage.StoredSnapshot
+	for _, snapshot := range snapshots {
+		if snapshot.LastModified.After(latest.LastModified) {
+			latest = snapshot
+		}
 	}
 
-	if info.Size() < 1 {
-		logging.Warn("Ignoring empty snapshot", "file", snapshot.Name(), "nextSnapshot", nextSnapshot)
-		return a.snapshotTicker
+	a.lastSnapshotSize = latest.Size
+	return latest.Size
+}
+
+// verifySnapshot verifies that the given snapshot is a complete raft-snapshot and returns its metadata
+func (a *SnapshotAgent) verifySnapshot(ctx context.Context, snapshot io.Reader) (storage.SnapshotMetadata, error) {
+	meta, err := raft.VerifySnapshot(snapshot)
+	if err != nil {
+		return storage.SnapshotMetadata{}, err
 	}
 
-	nextSnapshot = a.manager.UploadSnapshot(ctx, snapshot, info.Size(), a.lastSnapshotTime, a.storageConfigDefaults)
-	a.metrics.Collect(a.lastSnapshotTime, info.Size(), nextSnapshot)
-	return a.updateTicker(nextSnapshot)
+	return storage.SnapshotMetadata{
+		Node:         a.client.ConnectedNode(),
+		RaftIndex:    meta.Index,
+		RaftTerm:     meta.Term,
+		AgentVersion: a.version,
+		VaultVersion: a.client.VaultVersion(ctx),
+	}, nil
 }
 
 func (a *SnapshotAgent) updateTicker(nextSnapshot time.Time) *time.Ticker {
@@ -4,11 +4,13 @@ import (
 	"context"
 	"errors"
 	"io"
+	"math"
 	"testing"
 	"time"
 
 	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/metrics"
 	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/storage"
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/test"
 	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/vault"
 	"github.com/hashicorp/vault/api"
 
@@ -18,7 +20,7 @@ import (
 func TestTakeSnapshotUploadsSnapshot(t *testing.T) {
 	clientVaultAPI := &clientVaultAPIStub{
 		leader:       true,
-		snapshotData: "test",
+		snapshotData: string(test.RaftSnapshot(t, "test")),
 	}
 
 	defaults := storage.StorageConfigDefaults{
@@ -37,8 +39,10 @@ func TestTakeSnapshotUploadsSnapshot(t *testing.T) {
 
 	ctx := context.Background()
 
-	agent := newSnapshotAgent(t.TempDir())
-	assert.NoError(t, agent.update(ctx, newClient(clientVaultAPI), manager, defaults, collector))
+	agent := newSnapshotAgent()
+	agent.version = "test-version"
+	clientVaultAPI.version = "1.17.2"
+	assert.NoError(t, agent.update(ctx, newClient(clientVaultAPI), manager, defaults, BufferConfig{TempDir: t.TempDir()}, collector))
 
 	start := time.Now()
 	ticker := agent.TakeSnapshot(ctx)
@@ -48,6 +52,7 @@ func TestTakeSnapshotUploadsSnapshot(t *testing.T) {
 	assert.Equal(t, clientVaultAPI.snapshotData, factory.uploadData)
 	assert.Equal(t, defaults, factory.defaults)
 	assert.WithinRange(t, factory.snapshotTimestamp, start, start.Add(50*time.Millisecond))
+	assert.Equal(t, storage.SnapshotMetadata{Node: "http://node", RaftIndex: 10, RaftTerm: 2, AgentVersion: "test-version", VaultVersion: "1.17.2"}, factory.metadata)
 	assert.Equal(t, expectedNextSnapshot, factory.nextSnapshot)
 
 	assert.True(t, publisher.started)
@@ -56,6 +61,67 @@ func TestTakeSnapshotUploadsSnapshot(t *testing.T) {
 	assert.Equal(t, expectedNextSnapshot, publisher.nextSnapshotTime)
 }
 
+func TestTakeSingleSnapshotUploadsSnapshot(t *testing.T) {
+	clientVaultAPI := &clientVaultAPIStub{
+		leader:       true,
+		snapshotData: string(test.RaftSnapshot(t, "test")),
+	}
+
+	factory := &storageControllerFactoryStub{nextSnapshot: time.Now().Add(time.Hour)}
+	manager := &storage.Manager{}
+	manager.AddStorageFactory(factory)
+
+	ctx := context.Background()
+
+	agent := newSnapshotAgent()
+	assert.NoError(t, agent.update(ctx, newClient(clientVaultAPI), manager, storage.StorageConfigDefaults{}, BufferConfig{TempDir: t.TempDir()}, &metrics.Collector{}))
+
+	err := agent.TakeSingleSnapshot(ctx)
+
+	assert.NoError(t, err, "TakeSingleSnapshot failed unexpectedly")
+	assert.True(t, clientVaultAPI.tookSnapshot)
+	assert.Equal(t, clientVaultAPI.snapshotData, factory.uploadData)
+}
+
+func TestTakeSingleSnapshotFailsIfUploadFails(t *testing.T) {
+	clientVaultAPI := &clientVaultAPIStub{
+		leader:       true,
+		snapshotData: string(test.RaftSnapshot(t, "test")),
+	}
+
+	manager := &storage.Manager{}
+	manager.AddStorageFactory(&storageControllerFactoryStub{nextSnapshot: time.Now().Add(time.Hour)})
+	manager.AddStorageFactory(&storageControllerFactoryStub{nextSnapshot: time.Now().Add(time.Hour), uploadFails: true})
+
+	ctx := context.Background()
+
+	agent := newSnapshotAgent()
+	assert.NoError(t, agent.update(ctx, newClient(clientVaultAPI), manager, storage.StorageConfigDefaults{}, BufferConfig{TempDir: t.TempDir()}, &metrics.Collector{}))
+
+	err := agent.TakeSingleSnapshot(ctx)
+
+	assert.Error(t, err, "TakeSingleSnapshot should fail if upload to any storage fails")
+}
+
+func TestTakeSingleSnapshotFailsIfSnapshotFails(t *testing.T) {
+	clientVaultAPI := &clientVaultAPIStub{
+		leader:        true,
+		snapshotFails: true,
+	}
+
+	manager := &storage.Manager{}
+	manager.AddStorageFactory(&storageControllerFactoryStub{nextSnapshot: time.Now().Add(time.Hour)})
+
+	ctx := context.Background()
+
+	agent := newSnapshotAgent()
+	assert.NoError(t, agent.update(ctx, newClient(clientVaultAPI), manager, storage.StorageConfigDefaults{}, BufferConfig{TempDir: t.TempDir()}, &metrics.Collector{}))
+
+	err := agent.TakeSingleSnapshot(ctx)
+
+	assert.Error(t, err, "TakeSingleSnapshot should fail if snapshot fails")
+}
+
 func TestTakeSnapshotLocksTakeSnapshot(t *testing.T) {
 	clientVaultAPI := &clientVaultAPIStub{
 		leader:          true,
@@ -66,8 +132,8 @@ func TestTakeSnapshotLocksTakeSnapshot(t *testing.T) {
 
 	ctx := context.Background()
 
-	agent := newSnapshotAgent(t.TempDir())
-	assert.NoError(t, agent.update(ctx, newClient(clientVaultAPI), &storage.Manager{}, storage.StorageConfigDefaults{}, collector))
+	agent := newSnapshotAgent()
+	assert.NoError(t, agent.update(ctx, newClient(clientVaultAPI), &storage.Manager{}, storage.StorageConfigDefaults{}, BufferConfig{TempDir: t.TempDir()}, collector))
 
 	start := time.Now()
 
@@ -99,8 +165,8 @@ func TestTakeSnapshotLocksUpdate(t *testing.T) {
 
 	ctx := context.Background()
 
-	agent := newSnapshotAgent(t.TempDir())
-	assert.NoError(t, agent.update(ctx, newClient(clientVaultAPI), &storage.Manager{}, storage.StorageConfigDefaults{}, collector))
+	agent := newSnapshotAgent()
+	assert.NoError(t, agent.update(ctx, newClient(clientVaultAPI), &storage.Manager{}, storage.StorageConfigDefaults{}, BufferConfig{TempDir: t.TempDir()}, collector))
 
 	start := time.Now()
 
@@ -114,7 +180,7 @@ func TestTakeSnapshotLocksUpdate(t *testing.T) {
 
 	go func() {
 		<-running
-		assert.NoError(t, agent.update(ctx, newClient(clientVaultAPI), &storage.Manager{}, storage.StorageConfigDefaults{}, collector))
+		assert.NoError(t, agent.update(ctx, newClient(clientVaultAPI), &storage.Manager{}, storage.StorageConfigDefaults{}, BufferConfig{TempDir: t.TempDir()}, collector))
 		done <- true
 	}()
 
@@ -145,8 +211,8 @@ func TestTakeSnapshotFailsWhenTempFileCannotBeCreated(t *testing.T) {
 
 	ctx := context.Background()
 
-	agent := newSnapshotAgent("./missing")
-	assert.NoError(t, agent.update(ctx, newClient(clientVaultAPI), manager, defaults, collector))
+	agent := newSnapshotAgent()
+	assert.NoError(t, agent.update(ctx, newClient(clientVaultAPI), manager, defaults, BufferConfig{TempDir: "./missing"}, collector))
 
 	ticker := agent.TakeSnapshot(ctx)
 	<-ticker.C
@@ -178,8 +244,8 @@ func TestTakeSnapshotFailsWhenSnapshottingFails(t *testing.T) {
 
 	ctx := context.Background()
 
-	agent := newSnapshotAgent(t.TempDir())
-	assert.NoError(t, agent.update(ctx, newClient(clientVaultAPI), manager, defaults, collector))
+	agent := newSnapshotAgent()
+	assert.NoError(t, agent.update(ctx, newClient(clientVaultAPI), manager, defaults, BufferConfig{TempDir: t.TempDir()}, collector))
 
 	ticker := agent.TakeSnapshot(ctx)
 	<-ticker.C
@@ -213,8 +279,8 @@ func TestTakeSnapshotIgnoresEmptySnapshot(t *testing.T) {
 
 	ctx := context.Background()
 
-	agent := newSnapshotAgent(t.TempDir())
-	assert.NoError(t, agent.update(ctx, newClient(clientVaultAPI), manager, defaults, collector))
+	agent := newSnapshotAgent()
+	assert.NoError(t, agent.update(ctx, newClient(clientVaultAPI), manager, defaults, BufferConfig{TempDir: t.TempDir()}, collector))
 
 	ticker := agent.TakeSnapshot(ctx)
 	<-ticker.C
@@ -223,7 +289,7 @@ func TestTakeSnapshotIgnoresEmptySnapshot(t *testing.T) {
 	assert.Less(t, time.Now(), factory.nextSnapshot.Add(-defaults.Frequency))
 }
 
-func TestIgnoresZeroTimeForScheduling(t *testing.T) {
+func TestTakeSnapshotRefusesInvalidSnapshot(t *testing.T) {
 	clientVaultAPI := &clientVaultAPIStub{
 		leader:       true,
 		snapshotData: "test",
@@ -233,6 +299,43 @@ func TestIgnoresZeroTimeForScheduling(t *testing.T) {
 		Frequency: time.Millisecond * 150,
 	}
 
+	factory := &storageControllerFactoryStub{
+		nextSnapshot: time.Now().Add(defaults.Frequency * 4),
+	}
+
+	manager := &storage.Manager{}
+	manager.AddStorageFactory(factory)
+
+	publisher := PublisherStub{}
+	collector := &metrics.Collector{}
+	collector.AddPublisher(&publisher)
+
+	ctx := context.Background()
+
+	agent := newSnapshotAgent()
+	assert.NoError(t, agent.update(ctx, newClient(clientVaultAPI), manager, defaults, BufferConfig{TempDir: t.TempDir()}, collector))
+
+	ticker := agent.TakeSnapshot(ctx)
+	<-ticker.C
+
+	assert.True(t, clientVaultAPI.tookSnapshot)
+	assert.Zero(t, factory.uploadData)
+	assert.Less(t, time.Now(), factory.nextSnapshot.Add(-defaults.Frequency))
+
+	assert.False(t, publisher.success)
+	assert.NotEmpty(t, publisher.lastSnapshotTime)
+}
+
+func TestIgnoresZeroTimeForScheduling(t *testing.T) {
+	clientVaultAPI := &clientVaultAPIStub{
+		leader:       true,
+		snapshotData: string(test.RaftSnapshot(t, "test")),
+	}
+
+	defaults := storage.StorageConfigDefaults{
+		Frequency: time.Millisecond * 150,
+	}
+
 	factory := &storageControllerFactoryStub{
 		nextSnapshot: time.Time{},
 	}
@@ -244,8 +347,8 @@ func TestIgnoresZeroTimeForScheduling(t *testing.T) {
 
 	ctx := context.Background()
 
-	agent := newSnapshotAgent(t.TempDir())
-	assert.NoError(t, agent.update(ctx, newClient(clientVaultAPI), manager, defaults, collector))
+	agent := newSnapshotAgent()
+	assert.NoError(t, agent.update(ctx, newClient(clientVaultAPI), manager, defaults, BufferConfig{TempDir: t.TempDir()}, collector))
 
 	start := time.Now()
 	ticker := agent.TakeSnapshot(ctx)
@@ -259,7 +362,7 @@ func TestIgnoresZeroTimeForScheduling(t *testing.T) {
 func TestUpdateReschedulesSnapshots(t *testing.T) {
 	clientVaultAPI := &clientVaultAPIStub{
 		leader:       true,
-		snapshotData: "test",
+		snapshotData: string(test.RaftSnapshot(t, "test")),
 	}
 
 	manager := &storage.Manager{}
@@ -273,14 +376,14 @@ func TestUpdateReschedulesSnapshots(t *testing.T) {
 	collector := &metrics.Collector{}
 
 	ctx := context.Background()
-	agent := newSnapshotAgent(t.TempDir())
+	agent := newSnapshotAgent()
 	client := newClient(clientVaultAPI)
-	assert.NoError(t, agent.update(ctx, client, manager, storage.StorageConfigDefaults{}, collector))
+	assert.NoError(t, agent.update(ctx, client, manager, storage.StorageConfigDefaults{}, BufferConfig{TempDir: t.TempDir()}, collector))
 	ticker := agent.TakeSnapshot(ctx)
 
 	updated := make(chan bool, 1)
 	go func() {
-		assert.NoError(t, agent.update(ctx, client, newManager, storage.StorageConfigDefaults{}, collector))
+		assert.NoError(t, agent.update(ctx, client, newManager, storage.StorageConfigDefaults{}, BufferConfig{TempDir: t.TempDir()}, collector))
 		updated <- true
 	}()
 
@@ -291,6 +394,186 @@ func TestUpdateReschedulesSnapshots(t *testing.T) {
 	assert.Equal(t, newManager, agent.manager)
 }
 
+func TestUpdateAndCloseRevokeTokenOfClient(t *testing.T) {
+	clientVaultAPI := &clientVaultAPIStub{
+		leader:       true,
+		snapshotData: string(test.RaftSnapshot(t, "test")),
+	}
+
+	manager := &storage.Manager{}
+	manager.AddStorageFactory(&storageControllerFactoryStub{})
+
+	ctx := context.Background()
+	agent := newSnapshotAgent()
+
+	var oldRevoked, newRevoked bool
+	oldClient := vault.NewClient(clientVaultAPI, []string{"http://node"}, false, clientVaultAPIAuthStub{revoked: &oldRevoked})
+	newClient := vault.NewClient(clientVaultAPI, []string{"http://node"}, false, clientVaultAPIAuthStub{revoked: &newRevoked})
+
+	assert.NoError(t, agent.update(ctx, oldClient, manager, storage.StorageConfigDefaults{}, BufferConfig{TempDir: t.TempDir()}, &metrics.Collector{}))
+	assert.NoError(t, agent.TakeSingleSnapshot(ctx), "TakeSingleSnapshot() failed unexpectedly")
+
+	assert.NoError(t, agent.update(ctx, newClient, manager, storage.StorageConfigDefaults{}, BufferConfig{TempDir: t.TempDir()}, &metrics.Collector{}))
+	assert.True(t, oldRevoked)
+	assert.False(t, newRevoked)
+
+	assert.NoError(t, agent.TakeSingleSnapshot(ctx), "TakeSingleSnapshot() failed unexpectedly")
+	assert.NoError(t, agent.Close(ctx), "Close() failed unexpectedly")
+	assert.True(t, newRevoked)
+}
+
+func TestTakeSingleSnapshotBuffersSnapshotInMemory(t *testing.T) {
+	clientVaultAPI := &clientVaultAPIStub{
+		leader:       true,
+		snapshotData: string(test.RaftSnapshot(t, "test")),
+	}
+
+	factory := &storageControllerFactoryStub{nextSnapshot: time.Now().Add(time.Hour)}
+	manager := &storage.Manager{}
+	manager.AddStorageFactory(factory)
+
+	ctx := context.Background()
+
+	agent := newSnapshotAgent()
+	buffer := BufferConfig{Mode: "memory", TempDir: "./missing", MemoryLimit: 1024 * 1024}
+	assert.NoError(t, agent.update(ctx, newClient(clientVaultAPI), manager, storage.StorageConfigDefaults{}, buffer, &metrics.Collector{}))
+
+	err := agent.TakeSingleSnapshot(ctx)
+
+	assert.NoError(t, err, "TakeSingleSnapshot failed unexpectedly")
+	assert.Equal(t, clientVaultAPI.snapshotData, factory.uploadData)
+}
+
+func TestTakeSingleSnapshotFailsWithoutFreeSpace(t *testing.T) {
+	clientVaultAPI := &clientVaultAPIStub{
+		leader:       true,
+		snapshotData: string(test.RaftSnapshot(t, "test")),
+	}
+
+	manager := &storage.Manager{}
+	manager.AddStorageFactory(&storageControllerFactoryStub{nextSnapshot: time.Now().Add(time.Hour)})
+
+	ctx := context.Background()
+
+	agent := newSnapshotAgent()
+	buffer := BufferConfig{TempDir: t.TempDir(), MinFreeSpace: math.MaxInt64}
+	assert.NoError(t, agent.update(ctx, newClient(clientVaultAPI), manager, storage.StorageConfigDefaults{}, buffer, &metrics.Collector{}))
+
+	err := agent.TakeSingleSnapshot(ctx)
+
+	assert.Error(t, err, "TakeSingleSnapshot should fail without enough free space")
+	assert.False(t, clientVaultAPI.tookSnapshot)
+}
+
+func TestTakeSingleSnapshotExpectsSizeOfLatestStoredSnapshotOnFirstRun(t *testing.T) {
+	clientVaultAPI := &clientVaultAPIStub{
+		leader:       true,
+		snapshotData: string(test.RaftSnapshot(t, "test")),
+	}
+
+	factory := &storageControllerFactoryStub{
+		nextSnapshot: time.Now().Add(time.Hour),
+		snapshots: []storage.SnapshotInfo{
+			{Name: "old.snap", Size: 1, LastModified: time.Now().Add(-2 * time.Hour)},
+			{Name: "latest.snap", Size: math.MaxInt64, LastModified: time.Now().Add(-time.Hour)},
+		},
+	}
+	manager := &storage.Manager{}
+	manager.AddStorageFactory(factory)
+
+	ctx := context.Background()
+
+	agent := newSnapshotAgent()
+	assert.NoError(t, agent.update(ctx, newClient(clientVaultAPI), manager, storage.StorageConfigDefaults{}, BufferConfig{TempDir: t.TempDir()}, &metrics.Collector{}))
+
+	err := agent.TakeSingleSnapshot(ctx)
+
+	assert.Error(t, err, "TakeSingleSnapshot should fail without enough free space for the latest stored snapshot")
+	assert.False(t, clientVaultAPI.tookSnapshot)
+}
+
+func TestTakeSnapshotStreamsSnapshot(t *testing.T) {
+	clientVaultAPI := &clientVaultAPIStub{
+		leader:       true,
+		snapshotData: string(test.RaftSnapshot(t, "test")),
+	}
+
+	expectedNextSnapshot := time.Now().Add(time.Millisecond * 250)
+	factory := &storageControllerFactoryStub{nextSnapshot: expectedNextSnapshot}
+	manager := &storage.Manager{}
+	manager.AddStorageFactory(factory)
+
+	publisher := PublisherStub{}
+	collector := &metrics.Collector{}
+	collector.AddPublisher(&publisher)
+
+	ctx := context.Background()
+
+	agent := newSnapshotAgent()
+	assert.NoError(t, agent.update(ctx, newClient(clientVaultAPI), manager, storage.StorageConfigDefaults{}, BufferConfig{Mode: "stream"}, collector))
+
+	ticker := agent.TakeSnapshot(ctx)
+	<-ticker.C
+
+	assert.True(t, clientVaultAPI.tookSnapshot)
+	assert.Equal(t, clientVaultAPI.snapshotData, factory.uploadData)
+	assert.True(t, publisher.success)
+	assert.Equal(t, int64(len(clientVaultAPI.snapshotData)), publisher.size)
+	assert.Equal(t, expectedNextSnapshot, publisher.nextSnapshotTime)
+}
+
+func TestTakeSingleSnapshotFailsIfStreamedSnapshotIsInvalid(t *testing.T) {
+	clientVaultAPI := &clientVaultAPIStub{
+		leader:       true,
+		snapshotData: "invalid",
+	}
+
+	factory := &storageControllerFactoryStub{nextSnapshot: time.Now().Add(time.Hour)}
+	manager := &storage.Manager{}
+	manager.AddStorageFactory(factory)
+
+	publisher := PublisherStub{}
+	collector := &metrics.Collector{}
+	collector.AddPublisher(&publisher)
+
+	ctx := context.Background()
+
+	agent := newSnapshotAgent()
+	assert.NoError(t, agent.update(ctx, newClient(clientVaultAPI), manager, storage.StorageConfigDefaults{}, BufferConfig{Mode: "stream"}, collector))
+
+	err := agent.TakeSingleSnapshot(ctx)
+
+	assert.Error(t, err, "TakeSingleSnapshot should fail if streamed snapshot is invalid")
+	assert.Empty(t, factory.uploadData)
+	assert.False(t, publisher.success)
+}
+
+func TestTakeSingleSnapshotReportsFailureIfStreamedUploadFails(t *testing.T) {
+	clientVaultAPI := &clientVaultAPIStub{
+		leader:       true,
+		snapshotData: string(test.RaftSnapshot(t, "test")),
+	}
+
+	factory := &storageControllerFactoryStub{nextSnapshot: time.Now().Add(time.Hour), uploadFails: true}
+	manager := &storage.Manager{}
+	manager.AddStorageFactory(factory)
+
+	publisher := PublisherStub{}
+	collector := &metrics.Collector{}
+	collector.AddPublisher(&publisher)
+
+	ctx := context.Background()
+
+	agent := newSnapshotAgent()
+	assert.NoError(t, agent.update(ctx, newClient(clientVaultAPI), manager, storage.StorageConfigDefaults{}, BufferConfig{Mode: "stream"}, collector))
+
+	err := agent.TakeSingleSnapshot(ctx)
+
+	assert.Error(t, err, "TakeSingleSnapshot should fail if streamed upload fails")
+	assert.False(t, publisher.success)
+	assert.Zero(t, agent.lastSnapshotSize)
+}
+
 func newClient(api *clientVaultAPIStub) *vault.VaultClient {
 	return vault.NewClient(api, []string{"http://node"}, false, clientVaultAPIAuthStub{})
 }
@@ -301,6 +584,7 @@ type clientVaultAPIStub struct {
 	leader          bool
 	snapshotRuntime time.Duration
 	snapshotData    string
+	version         string
 }
 
 func (stub *clientVaultAPIStub) Connect(node string) (*api.Client, error) {
@@ -330,22 +614,41 @@ func (stub *clientVaultAPIStub) TakeSnapshot(ctx context.Context, _ *api.Client,
 	return nil
 }
 
+func (stub *clientVaultAPIStub) RestoreSnapshot(context.Context, *api.Client, io.Reader, bool) error {
+	return errors.New("RestoreSnapshot not supported")
+}
+
+func (stub *clientVaultAPIStub) GetVersion(context.Context, *api.Client) (string, error) {
+	return stub.version, nil
+}
+
 func (stub *clientVaultAPIStub) GetLeader(context.Context, *api.Client) (bool, string) {
 	return stub.leader, ""
 }
 
-type clientVaultAPIAuthStub struct{}
+type clientVaultAPIAuthStub struct {
+	revoked *bool
+}
 
 func (stub clientVaultAPIAuthStub) Refresh(context.Context, *api.Client, bool) error {
 	return nil
 }
 
+func (stub clientVaultAPIAuthStub) Revoke(context.Context, *api.Client) error {
+	if stub.revoked != nil {
+		*stub.revoked = true
+	}
+	return nil
+}
+
 type storageControllerFactoryStub struct {
 	defaults          storage.StorageConfigDefaults
 	uploadData        string
 	uploadFails       bool
 	snapshotTimestamp time.Time
+	metadata          storage.SnapshotMetadata
 	nextSnapshot      time.Time
+	snapshots         []storage.SnapshotInfo
 }
 
 func (stub *storageControllerFactoryStub) Destination() string {
@@ -368,8 +671,21 @@ func (stub storageControllerStub) DeleteObsoleteSnapshots(_ context.Context, _ s
 	return 0, nil
 }
 
-func (stub storageControllerStub) UploadSnapshot(_ context.Context, snapshot io.Reader, _ int64, timestamp time.Time, defaults storage.StorageConfigDefaults) (bool, time.Time, error) {
+func (stub storageControllerStub) ListSnapshots(context.Context, storage.StorageConfigDefaults) ([]storage.SnapshotInfo, error) {
+	return stub.factory.snapshots, nil
+}
+
+func (stub storageControllerStub) DownloadSnapshot(context.Context, string, storage.StorageConfigDefaults) (io.ReadCloser, error) {
+	return nil, errors.New("download not supported")
+}
+
+func (stub storageControllerStub) Close() error {
+	return nil
+}
+
+func (stub storageControllerStub) UploadSnapshot(_ context.Context, snapshot io.Reader, _ int64, timestamp time.Time, metadata storage.SnapshotMetadata, defaults storage.StorageConfigDefaults) (bool, time.Time, error) {
 	stub.factory.snapshotTimestamp = timestamp
+	stub.factory.metadata = metadata
 	stub.factory.defaults = defaults
 	if stub.factory.uploadFails {
 		return false, stub.factory.nextSnapshot, errors.New("upload failed")
@@ -417,3 +733,5 @@ func (p *PublisherStub) PublishFailure(timestamp time.Time) {
 	p.lastSnapshotTime = timestamp
 	p.success = false
 }
+
+func (p *PublisherStub) PublishRetry(string) {}
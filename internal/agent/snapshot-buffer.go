@@ -0,0 +1,150 @@
+package agent
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	bufferModeFile   = "file"
+	bufferModeMemory = "memory"
+	bufferModeStream = "stream"
+)
+
+// BufferConfig configures how snapshots are buffered before they are uploaded to the storages.
+// In file-mode snapshots are written to a temporary file, in memory-mode they are kept in memory up to MemoryLimit
+// bytes and in stream-mode they are uploaded to all storages while they are read from vault
+type BufferConfig struct {
+	Mode         string `default:"file" validate:"oneof=file memory stream"`
+	TempDir      string
+	MemoryLimit  int64 `default:"67108864" validate:"gte=0"`
+	MinFreeSpace int64 `validate:"gte=0"`
+}
+
+// tempDir returns the directory for temporary files
+func (c BufferConfig) tempDir() string {
+	if c.TempDir == "" {
+		return os.TempDir()
+	}
+	return c.TempDir
+}
+
+// memoryLimit returns the number of bytes buffered in memory before the snapshot is written to a temporary file
+func (c BufferConfig) memoryLimit() int64 {
+	if c.Mode == bufferModeMemory {
+		return c.MemoryLimit
+	}
+	return 0
+}
+
+// ensureFreeSpace checks that the temp-dir has enough free space to buffer a snapshot of the expected size
+func (c BufferConfig) ensureFreeSpace(expectedSize int64) error {
+	required := max(c.MinFreeSpace, expectedSize-c.memoryLimit())
+	if required <= 0 {
+		return nil
+	}
+
+	available, err := freeSpace(c.tempDir())
+	if err != nil {
+		return err
+	}
+
+	if available >= 0 && available < required {
+		return fmt.Errorf("insufficient free space in %s: %d bytes required, %d bytes available", c.tempDir(), required, available)
+	}
+
+	return nil
+}
+
+// CreateTempFile creates a temporary file in the temp-dir after checking that the temp-dir has enough free space
+// for a snapshot of the expected size; expectedSize may be 0 if the size is unknown
+func (c BufferConfig) CreateTempFile(expectedSize int64) (*os.File, error) {
+	// the file is written completely, so the memory-limit does not reduce the required space
+	fileConfig := c
+	fileConfig.Mode = bufferModeFile
+	if err := fileConfig.ensureFreeSpace(expectedSize); err != nil {
+		return nil, err
+	}
+
+	return os.CreateTemp(c.tempDir(), "snapshot")
+}
+
+// snapshotBuffer buffers a snapshot in memory up to a limit and in a temporary file beyond it
+type snapshotBuffer struct {
+	dir    string
+	limit  int64
+	memory []byte
+	file   *os.File
+	size   int64
+}
+
+// newSnapshotBuffer creates a snapshotBuffer; if the memory-limit is 0 the temporary file is created immediately
+func newSnapshotBuffer(dir string, memoryLimit int64) (*snapshotBuffer, error) {
+	buffer := &snapshotBuffer{dir: dir, limit: memoryLimit}
+	if memoryLimit <= 0 {
+		if err := buffer.spill(); err != nil {
+			return nil, err
+		}
+	}
+	return buffer, nil
+}
+
+func (b *snapshotBuffer) Write(p []byte) (int, error) {
+	if b.file == nil && b.size+int64(len(p)) > b.limit {
+		if err := b.spill(); err != nil {
+			return 0, err
+		}
+	}
+
+	if b.file != nil {
+		n, err := b.file.Write(p)
+		b.size += int64(n)
+		return n, err
+	}
+
+	b.memory = append(b.memory, p...)
+	b.size += int64(len(p))
+	return len(p), nil
+}
+
+func (b *snapshotBuffer) ReadAt(p []byte, off int64) (int, error) {
+	if b.file != nil {
+		return b.file.ReadAt(p, off)
+	}
+	return bytes.NewReader(b.memory).ReadAt(p, off)
+}
+
+// Size returns the number of bytes written to the buffer
+func (b *snapshotBuffer) Size() int64 {
+	return b.size
+}
+
+// Close releases the buffered data and removes the temporary file, if any
+func (b *snapshotBuffer) Close() error {
+	b.memory = nil
+	if b.file == nil {
+		return nil
+	}
+
+	return errors.Join(b.file.Close(), os.Remove(b.file.Name()))
+}
+
+// spill moves the data buffered in memory to a temporary file
+func (b *snapshotBuffer) spill() error {
+	file, err := os.CreateTemp(b.dir, "snapshot")
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(b.memory); err != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return err
+	}
+
+	b.file = file
+	b.memory = nil
+	return nil
+}
@@ -0,0 +1,99 @@
+package agent
+
+import (
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotBufferKeepsDataInMemoryUpToLimit(t *testing.T) {
+	dir := t.TempDir()
+	buffer, err := newSnapshotBuffer(dir, 8)
+	assert.NoError(t, err, "newSnapshotBuffer() failed unexpectedly")
+	defer buffer.Close()
+
+	_, err = buffer.Write([]byte("test"))
+	assert.NoError(t, err, "Write() failed unexpectedly")
+
+	assert.Nil(t, buffer.file)
+	assert.Equal(t, int64(4), buffer.Size())
+	assertBufferContains(t, buffer, "test")
+	assertDirEntries(t, dir, 0)
+}
+
+func TestSnapshotBufferSpillsToFileBeyondLimit(t *testing.T) {
+	dir := t.TempDir()
+	buffer, err := newSnapshotBuffer(dir, 6)
+	assert.NoError(t, err, "newSnapshotBuffer() failed unexpectedly")
+
+	_, err = buffer.Write([]byte("test"))
+	assert.NoError(t, err, "Write() failed unexpectedly")
+	_, err = buffer.Write([]byte("data"))
+	assert.NoError(t, err, "Write() failed unexpectedly")
+
+	assert.NotNil(t, buffer.file)
+	assert.Nil(t, buffer.memory)
+	assert.Equal(t, int64(8), buffer.Size())
+	assertBufferContains(t, buffer, "testdata")
+	assertDirEntries(t, dir, 1)
+
+	assert.NoError(t, buffer.Close(), "Close() failed unexpectedly")
+	assertDirEntries(t, dir, 0)
+}
+
+func TestSnapshotBufferWithoutMemoryLimitCreatesFileImmediately(t *testing.T) {
+	dir := t.TempDir()
+	buffer, err := newSnapshotBuffer(dir, 0)
+	assert.NoError(t, err, "newSnapshotBuffer() failed unexpectedly")
+	defer buffer.Close()
+
+	assertDirEntries(t, dir, 1)
+
+	_, err = newSnapshotBuffer("./missing", 0)
+	assert.Error(t, err, "newSnapshotBuffer() should fail for missing directory")
+}
+
+func TestBufferConfigEnsuresFreeSpace(t *testing.T) {
+	dir := t.TempDir()
+
+	assert.NoError(t, BufferConfig{TempDir: dir}.ensureFreeSpace(1))
+	assert.Error(t, BufferConfig{TempDir: dir, MinFreeSpace: math.MaxInt64}.ensureFreeSpace(0))
+	assert.Error(t, BufferConfig{TempDir: dir}.ensureFreeSpace(math.MaxInt64))
+	assert.NoError(t, BufferConfig{Mode: "memory", TempDir: dir, MemoryLimit: math.MaxInt64}.ensureFreeSpace(math.MaxInt64))
+	assert.Error(t, BufferConfig{TempDir: "./missing"}.ensureFreeSpace(1))
+}
+
+func TestBufferConfigCreatesTempFileInTempDir(t *testing.T) {
+	dir := t.TempDir()
+
+	file, err := BufferConfig{TempDir: dir}.CreateTempFile(1)
+	assert.NoError(t, err, "CreateTempFile() failed unexpectedly")
+	defer file.Close()
+	assert.Equal(t, dir, filepath.Dir(file.Name()))
+
+	_, err = BufferConfig{TempDir: dir, MinFreeSpace: math.MaxInt64}.CreateTempFile(0)
+	assert.Error(t, err, "CreateTempFile() should fail for insufficient free space")
+
+	_, err = BufferConfig{Mode: "memory", TempDir: dir, MemoryLimit: math.MaxInt64}.CreateTempFile(math.MaxInt64)
+	assert.Error(t, err, "CreateTempFile() should ignore the memory-limit")
+}
+
+func assertBufferContains(t *testing.T, buffer *snapshotBuffer, expected string) {
+	t.Helper()
+
+	data, err := io.ReadAll(io.NewSectionReader(buffer, 0, buffer.Size()))
+	assert.NoError(t, err, "could not read buffer")
+	assert.Equal(t, expected, string(data))
+}
+
+func assertDirEntries(t *testing.T, dir string, expected int) {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err, "could not read directory")
+	assert.Len(t, entries, expected)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/config/secret"
 	"io"
+	"path"
 	"strings"
 	"time"
 
@@ -37,7 +38,17 @@ type awsStorageImpl struct {
 }
 
 func (conf AWSStorageConfig) Destination() string {
-	return fmt.Sprintf("aws s3 bucket %s at %s", conf.Bucket, conf.Endpoint)
+	destination := fmt.Sprintf("aws s3 bucket %s", path.Join(conf.Bucket, conf.KeyPrefix))
+
+	// region and endpoint usually reference environment-variables, so their resolved values are used
+	if region, err := conf.Region.Resolve(false); err == nil && region != "" {
+		destination += fmt.Sprintf(" in region %s", region)
+	}
+	if endpoint, err := conf.Endpoint.Resolve(false); err == nil && endpoint != "" {
+		destination += fmt.Sprintf(" at %s", endpoint)
+	}
+
+	return conf.describeDestination(destination)
 }
 
 func (conf AWSStorageConfig) CreateController(ctx context.Context) (StorageController, error) {
@@ -112,10 +123,14 @@ func (conf AWSStorageConfig) createClient(ctx context.Context) (*awsS3.Client, e
 // implements interface storage
 func (s awsStorageImpl) uploadSnapshot(ctx context.Context, name string, data io.Reader, size int64) error {
 	input := &awsS3.PutObjectInput{
-		Bucket:        &s.bucket,
-		Key:           aws.String(s.keyPrefix + name),
-		Body:          data,
-		ContentLength: &size,
+		Bucket: &s.bucket,
+		Key:    aws.String(s.keyPrefix + name),
+		Body:   data,
+	}
+
+	// the size of compressed snapshots is unknown
+	if size >= 0 {
+		input.ContentLength = &size
 	}
 
 	if s.sse {
@@ -147,29 +162,61 @@ func (s awsStorageImpl) deleteSnapshot(ctx context.Context, snapshot awsS3Types.
 
 // nolint:unused
 // implements interface storage
-func (s awsStorageImpl) listSnapshots(ctx context.Context, prefix string, ext string) ([]awsS3Types.Object, error) {
+func (s awsStorageImpl) listSnapshots(ctx context.Context, prefix string, ext string, _ bool) ([]awsS3Types.Object, error) {
 	var result []awsS3Types.Object
 
-	existingSnapshotList, err := s.client.ListObjectsV2(ctx, &awsS3.ListObjectsV2Input{
+	paginator := awsS3.NewListObjectsV2Paginator(s.client, &awsS3.ListObjectsV2Input{
 		Bucket: &s.bucket,
 		Prefix: aws.String(s.keyPrefix),
 	})
 
-	if err != nil {
-		return result, err
-	}
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return result, err
+		}
 
-	for _, obj := range existingSnapshotList.Contents {
-		if strings.HasSuffix(*obj.Key, ext) && strings.Contains(*obj.Key, prefix) {
-			result = append(result, obj)
+		for _, obj := range page.Contents {
+			if strings.HasSuffix(*obj.Key, ext) && strings.Contains(*obj.Key, prefix) {
+				result = append(result, obj)
+			}
 		}
 	}
 
 	return result, nil
 }
 
+// nolint:unused
+// implements interface storage
+func (s awsStorageImpl) downloadSnapshot(ctx context.Context, snapshot awsS3Types.Object) (io.ReadCloser, error) {
+	output, err := s.client.GetObject(ctx, &awsS3.GetObjectInput{
+		Bucket: &s.bucket,
+		Key:    snapshot.Key,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return output.Body, nil
+}
+
+// nolint:unused
+// implements interface storage
+func (s awsStorageImpl) getName(snapshot awsS3Types.Object) string {
+	return strings.TrimPrefix(*snapshot.Key, s.keyPrefix)
+}
+
 // nolint:unused
 // implements interface storage
 func (s awsStorageImpl) getLastModifiedTime(snapshot awsS3Types.Object) time.Time {
 	return *snapshot.LastModified
 }
+
+// nolint:unused
+// implements interface storage
+func (s awsStorageImpl) getSize(snapshot awsS3Types.Object) int64 {
+	if snapshot.Size == nil {
+		return 0
+	}
+	return *snapshot.Size
+}
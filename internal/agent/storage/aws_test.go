@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/config/secret"
+	"github.com/stretchr/testify/assert"
+	"github.com/thoas/go-funk"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsS3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	awsS3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestAWSDestinationUsesResolvedRegionAndEndpoint(t *testing.T) {
+	t.Setenv("AWS_DEFAULT_REGION", "eu-central-1")
+	t.Setenv("AWS_ENDPOINT_URL", "")
+
+	config := AWSStorageConfig{
+		Bucket:    "bucket",
+		KeyPrefix: "prefix",
+		Region:    secret.FromEnv("AWS_DEFAULT_REGION"),
+		Endpoint:  secret.FromEnv("AWS_ENDPOINT_URL"),
+	}
+	assert.Equal(t, "aws s3 bucket bucket/prefix in region eu-central-1", config.Destination())
+
+	config.Endpoint = secret.FromString("https://s3.example.com")
+	assert.Equal(t, "aws s3 bucket bucket/prefix in region eu-central-1 at https://s3.example.com", config.Destination())
+}
+
+func TestAWSListSnapshotsReadsAllPages(t *testing.T) {
+	pages := [][]string{
+		{"prefix/test-1.snap", "prefix/other-1.snap"},
+		{"prefix/test-2.snap", "prefix/test-2.other"},
+		{"prefix/test-3.snap"},
+	}
+
+	var continuationTokens []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("continuation-token")
+		continuationTokens = append(continuationTokens, token)
+
+		page := 0
+		if token != "" {
+			_, _ = fmt.Sscanf(token, "page-%d", &page)
+		}
+
+		w.Header().Set("Content-Type", "application/xml")
+		_, _ = fmt.Fprint(w, listObjectsV2Response(pages, page))
+	}))
+	defer server.Close()
+
+	impl := awsStorageImpl{
+		client: awsS3.New(awsS3.Options{
+			BaseEndpoint: aws.String(server.URL),
+			Region:       "us-east-1",
+			UsePathStyle: true,
+			Credentials:  aws.AnonymousCredentials{},
+		}),
+		keyPrefix: "prefix/",
+		bucket:    "bucket",
+	}
+
+	snapshots, err := impl.listSnapshots(context.Background(), "test", ".snap", false)
+	assert.NoError(t, err, "listSnapshots() failed unexpectedly!")
+
+	names := funk.Map(snapshots, func(s awsS3Types.Object) string { return impl.getName(s) })
+	assert.Equal(t, []string{"test-1.snap", "test-2.snap", "test-3.snap"}, names)
+	assert.Equal(t, []string{"", "page-1", "page-2"}, continuationTokens)
+}
+
+func listObjectsV2Response(pages [][]string, page int) string {
+	response := strings.Builder{}
+	response.WriteString(`<?xml version="1.0" encoding="UTF-8"?>`)
+	response.WriteString(`<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><Name>bucket</Name><Prefix>prefix/</Prefix>`)
+	for _, key := range pages[page] {
+		response.WriteString(fmt.Sprintf("<Contents><Key>%s</Key><LastModified>2024-01-01T00:00:00.000Z</LastModified><Size>4</Size></Contents>", key))
+	}
+	response.WriteString(fmt.Sprintf("<KeyCount>%d</KeyCount>", len(pages[page])))
+	if page+1 < len(pages) {
+		response.WriteString(fmt.Sprintf("<IsTruncated>true</IsTruncated><NextContinuationToken>page-%d</NextContinuationToken>", page+1))
+	} else {
+		response.WriteString("<IsTruncated>false</IsTruncated>")
+	}
+	response.WriteString("</ListBucketResult>")
+	return response.String()
+}
@@ -25,7 +25,7 @@ type azureStorageImpl struct {
 }
 
 func (conf AzureStorageConfig) Destination() string {
-	return fmt.Sprintf("azure container %s at %s", conf.Container, conf.CloudDomain)
+	return conf.describeDestination(fmt.Sprintf("azure container %s of account %s at %s", conf.Container, conf.AccountName, conf.CloudDomain))
 }
 
 func (conf AzureStorageConfig) CreateController(context.Context) (StorageController, error) {
@@ -88,7 +88,7 @@ func (s azureStorageImpl) deleteSnapshot(ctx context.Context, snapshot *containe
 
 // nolint:unused
 // implements interface storage
-func (s azureStorageImpl) listSnapshots(ctx context.Context, prefix string, _ string) ([]*container.BlobItem, error) {
+func (s azureStorageImpl) listSnapshots(ctx context.Context, prefix string, _ string, _ bool) ([]*container.BlobItem, error) {
 	var results []*container.BlobItem
 
 	var maxResults int32 = 500
@@ -111,8 +111,34 @@ func (s azureStorageImpl) listSnapshots(ctx context.Context, prefix string, _ st
 	return results, nil
 }
 
+// nolint:unused
+// implements interface storage
+func (s azureStorageImpl) downloadSnapshot(ctx context.Context, snapshot *container.BlobItem) (io.ReadCloser, error) {
+	response, err := s.client.DownloadStream(ctx, s.container, *snapshot.Name, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Body, nil
+}
+
+// nolint:unused
+// implements interface storage
+func (s azureStorageImpl) getName(snapshot *container.BlobItem) string {
+	return *snapshot.Name
+}
+
 // nolint:unused
 // implements interface storage
 func (s azureStorageImpl) getLastModifiedTime(snapshot *container.BlobItem) time.Time {
 	return *snapshot.Properties.LastModified
 }
+
+// nolint:unused
+// implements interface storage
+func (s azureStorageImpl) getSize(snapshot *container.BlobItem) int64 {
+	if snapshot.Properties.ContentLength == nil {
+		return 0
+	}
+	return *snapshot.Properties.ContentLength
+}
@@ -1,45 +1,173 @@
 package storage
 
 import (
+	"fmt"
+	"slices"
+	"strings"
 	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/robfig/cron/v3"
+
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/compression"
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/config"
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/encryption"
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/logging"
 )
 
-// StoragesConfig specified the configuration-section for the storages to which snapshots are uploaded
+func init() {
+	config.RegisterValidation("layout", validateLayout)
+}
+
+// validateLayout validates that a layout contains at least one time-field and does not leave the storage's location
+func validateLayout(field validator.FieldLevel) bool {
+	layout := field.Field().String()
+	if layout == "" {
+		return true
+	}
+
+	if slices.Contains(strings.Split(layout, "/"), "..") {
+		return false
+	}
+
+	// a layout without time-fields is formatted to itself and would store all snapshots in the same directory
+	return time.Date(1999, time.December, 31, 23, 59, 59, 0, time.UTC).Format(layout) != layout
+}
+
+// StoragesConfig specified the configuration-section for the storages to which snapshots are uploaded.
+// Each storage-type accepts a single configuration or a list of configurations.
+// Concurrency limits the number of storages a snapshot is uploaded to at the same time; 0 means no limit
 type StoragesConfig struct {
-	AWS   *AWSStorageConfig
-	Azure *AzureStorageConfig
-	GCP   *GCPStorageConfig
-	Local *LocalStorageConfig
-	Swift *SwiftStorageConfig
-	S3    *S3StorageConfig
+	AWS         []AWSStorageConfig    `validate:"dive"`
+	Azure       []AzureStorageConfig  `validate:"dive"`
+	GCP         []GCPStorageConfig    `validate:"dive"`
+	Local       []LocalStorageConfig  `validate:"dive"`
+	Swift       []SwiftStorageConfig  `validate:"dive"`
+	S3          []S3StorageConfig     `validate:"dive"`
+	SFTP        []SFTPStorageConfig   `validate:"dive"`
+	WebDAV      []WebDAVStorageConfig `validate:"dive"`
+	Concurrency int                   `validate:"gte=0"`
+}
+
+// HasStorages returns true if at least one storage is configured
+func (c StoragesConfig) HasStorages() bool {
+	return len(c.factories()) > 0
+}
+
+// Factories returns the StorageControllerFactory of each configured storage by the storage's name.
+// The name of a storage is its type, e.g. aws or local; if more than one storage of a type is configured,
+// their names are suffixed with their 1-based position in the list, e.g. aws-1 and aws-2
+func (c StoragesConfig) Factories() map[string]StorageControllerFactory {
+	factories := map[string]StorageControllerFactory{}
+
+	for _, f := range c.factories() {
+		factories[f.name] = f.factory
+	}
+
+	return factories
+}
+
+type namedStorageControllerFactory struct {
+	name    string
+	factory StorageControllerFactory
+}
+
+// factories returns the StorageControllerFactory of each configured storage in the order of their types
+func (c StoragesConfig) factories() []namedStorageControllerFactory {
+	var factories []namedStorageControllerFactory
+
+	factories = appendFactories(factories, "aws", c.AWS)
+	factories = appendFactories(factories, "azure", c.Azure)
+	factories = appendFactories(factories, "gcp", c.GCP)
+	factories = appendFactories(factories, "local", c.Local)
+	factories = appendFactories(factories, "swift", c.Swift)
+	factories = appendFactories(factories, "s3", c.S3)
+	factories = appendFactories(factories, "sftp", c.SFTP)
+	factories = appendFactories(factories, "webdav", c.WebDAV)
+
+	return factories
+}
+
+func appendFactories[F StorageControllerFactory](factories []namedStorageControllerFactory, storageType string, configs []F) []namedStorageControllerFactory {
+	for i, config := range configs {
+		name := storageType
+		if len(configs) > 1 {
+			name = fmt.Sprintf("%s-%d", storageType, i+1)
+		}
+		factories = append(factories, namedStorageControllerFactory{name, config})
+	}
+	return factories
 }
 
 // StorageConfigDefaults specified the default values of StorageControllerConfig for all factories
 type StorageConfigDefaults struct {
 	Frequency       time.Duration `default:"1h"`
+	Schedule        string        `validate:"omitempty,cron"`
 	Retain          int
+	Retention       RetentionConfig
+	MaxAge          time.Duration
+	MaxTotalSize    int64         `validate:"gte=0"`
 	Timeout         time.Duration `default:"60s"`
 	NamePrefix      string        `default:"raft-snapshot-"`
 	NameSuffix      string        `default:".snap"`
 	TimestampFormat string        `default:"2006-01-02T15-04-05Z-0700"`
+	Layout          string        `validate:"layout"`
+	Compression     *compression.CompressionConfig
+	Encryption      *encryption.EncryptionConfig
+	Retry           RetryConfig
 }
 
 // StorageControllerConfig specifies the values for a single controller.
 // It is the base for all storage-specific configurations
 type StorageControllerConfig struct {
 	Frequency       time.Duration
+	Schedule        string `validate:"omitempty,cron"`
 	Retain          *int
+	Retention       *RetentionConfig
+	MaxAge          time.Duration
+	MaxTotalSize    int64 `validate:"gte=0"`
 	Timeout         time.Duration
 	NamePrefix      string
 	NameSuffix      string
 	TimestampFormat string
+	Layout          string `validate:"layout"`
+	Compression     *compression.CompressionConfig
+	Encryption      *encryption.EncryptionConfig
+	Retry           *RetryConfig
 }
 
-func (c StorageControllerConfig) frequencyOrDefault(defaults StorageConfigDefaults) time.Duration {
+// NextSnapshot returns the time of the next snapshot after the given time of the last snapshot.
+// If a Schedule is configured, the next time matching the schedule is returned,
+// otherwise (or if the schedule is invalid) the Frequency is added to the time of the last snapshot
+func (d StorageConfigDefaults) NextSnapshot(lastSnapshot time.Time) time.Time {
+	if d.Schedule != "" {
+		next, err := nextScheduledTime(d.Schedule, lastSnapshot)
+		if err == nil {
+			return next
+		}
+		logging.Warn("Could not schedule snapshot, falling back on frequency", "schedule", d.Schedule, "error", err)
+	}
+	return lastSnapshot.Add(d.Frequency)
+}
+
+// nextSnapshotOrDefault returns the time of the next snapshot after the given time of the last snapshot.
+// A Schedule takes precedence over a Frequency; if neither is configured, the StorageConfigDefaults are used
+func (c StorageControllerConfig) nextSnapshotOrDefault(lastSnapshot time.Time, defaults StorageConfigDefaults) (time.Time, error) {
+	if c.Schedule != "" {
+		return nextScheduledTime(c.Schedule, lastSnapshot)
+	}
 	if c.Frequency > 0 {
-		return c.Frequency
+		return lastSnapshot.Add(c.Frequency), nil
 	}
-	return defaults.Frequency
+	return defaults.NextSnapshot(lastSnapshot), nil
+}
+
+func nextScheduledTime(schedule string, lastSnapshot time.Time) (time.Time, error) {
+	parsed, err := cron.ParseStandard(schedule)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid schedule %s: %w", schedule, err)
+	}
+	return parsed.Next(lastSnapshot), nil
 }
 
 func (c StorageControllerConfig) retainOrDefault(defaults StorageConfigDefaults) int {
@@ -49,6 +177,27 @@ func (c StorageControllerConfig) retainOrDefault(defaults StorageConfigDefaults)
 	return defaults.Retain
 }
 
+func (c StorageControllerConfig) retentionOrDefault(defaults StorageConfigDefaults) RetentionConfig {
+	if c.Retention != nil {
+		return *c.Retention
+	}
+	return defaults.Retention
+}
+
+func (c StorageControllerConfig) maxAgeOrDefault(defaults StorageConfigDefaults) time.Duration {
+	if c.MaxAge > 0 {
+		return c.MaxAge
+	}
+	return defaults.MaxAge
+}
+
+func (c StorageControllerConfig) maxTotalSizeOrDefault(defaults StorageConfigDefaults) int64 {
+	if c.MaxTotalSize > 0 {
+		return c.MaxTotalSize
+	}
+	return defaults.MaxTotalSize
+}
+
 func (c StorageControllerConfig) timeoutOrDefault(defaults StorageConfigDefaults) time.Duration {
 	if c.Timeout > 0 {
 		return c.Timeout
@@ -76,3 +225,43 @@ func (c StorageControllerConfig) timestampFormatOrDefault(defaults StorageConfig
 	}
 	return defaults.TimestampFormat
 }
+
+func (c StorageControllerConfig) layoutOrDefault(defaults StorageConfigDefaults) string {
+	if c.Layout != "" {
+		return c.Layout
+	}
+	return defaults.Layout
+}
+
+func (c StorageControllerConfig) compressionOrDefault(defaults StorageConfigDefaults) *compression.CompressionConfig {
+	if c.Compression != nil {
+		return c.Compression
+	}
+	return defaults.Compression
+}
+
+func (c StorageControllerConfig) retryOrDefault(defaults StorageConfigDefaults) RetryConfig {
+	if c.Retry != nil {
+		return *c.Retry
+	}
+	return defaults.Retry
+}
+
+func (c StorageControllerConfig) encryptionOrDefault(defaults StorageConfigDefaults) *encryption.EncryptionConfig {
+	if c.Encryption != nil {
+		return c.Encryption
+	}
+	return defaults.Encryption
+}
+
+// describeDestination appends the configured name-prefix and layout to the given description of a storage's destination,
+// so that storages writing to the same location can be told apart
+func (c StorageControllerConfig) describeDestination(destination string) string {
+	if c.NamePrefix != "" {
+		destination += fmt.Sprintf(" with name-prefix %s", c.NamePrefix)
+	}
+	if c.Layout != "" {
+		destination += fmt.Sprintf(" in layout %s", c.Layout)
+	}
+	return destination
+}
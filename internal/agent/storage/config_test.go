@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatesLayout(t *testing.T) {
+	validate := validator.New()
+	assert.NoError(t, validate.RegisterValidation("layout", validateLayout))
+
+	for _, tc := range []struct {
+		layout string
+		valid  bool
+	}{
+		{"", true},
+		{"2006/01/02", true},
+		{"backups/2006-01", true},
+		{"backups", false},
+		{"../2006/01", false},
+		{"2006/../01", false},
+	} {
+		err := validate.Struct(StorageControllerConfig{Layout: tc.layout})
+		if tc.valid {
+			assert.NoError(t, err, "layout %s should be valid", tc.layout)
+		} else {
+			assert.Error(t, err, "layout %s should be invalid", tc.layout)
+		}
+	}
+}
@@ -3,8 +3,12 @@ package storage
 import (
 	"context"
 	"errors"
+	"fmt"
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/compression"
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/encryption"
 	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/logging"
 	"io"
+	"path"
 	"slices"
 	"strings"
 	"time"
@@ -12,19 +16,24 @@ import (
 
 // storageControllerImpl implements StorageController.
 // Access to the storage-location is delegated to the given storage.
-// Options like upload-frequency, snapshot-naming are configured by the given StorageControllerConfig.
+// Options like upload-frequency or -schedule, snapshot-naming are configured by the given StorageControllerConfig.
 type storageControllerImpl[S any] struct {
 	config     StorageControllerConfig
 	storage    storage[S]
 	lastUpload time.Time
 }
 
-// storage defines the interface used by storageControllerImpl to access a storage-location
+// storage defines the interface used by storageControllerImpl to access a storage-location.
+// The names of snapshots may contain directories separated by slashes; listSnapshots includes the snapshots in
+// sub-directories if recursive is true and storages deleting a snapshot should delete its parent-directories if empty
 type storage[S any] interface {
 	uploadSnapshot(ctx context.Context, name string, data io.Reader, size int64) error
 	deleteSnapshot(ctx context.Context, snapshot S) error
-	listSnapshots(ctx context.Context, prefix string, suffix string) ([]S, error)
+	listSnapshots(ctx context.Context, prefix string, suffix string, recursive bool) ([]S, error)
+	downloadSnapshot(ctx context.Context, snapshot S) (io.ReadCloser, error)
+	getName(snapshot S) string
 	getLastModifiedTime(snapshot S) time.Time
+	getSize(snapshot S) int64
 }
 
 // newStorageController creates a new storageControllerImpl uploading snapshots to the
@@ -41,72 +50,302 @@ func (u *storageControllerImpl[S]) ScheduleSnapshot(ctx context.Context, lastSna
 		return time.Time{}, err
 	}
 
-	return u.lastUpload.Add(u.config.frequencyOrDefault(defaults)), nil
+	return u.config.nextSnapshotOrDefault(u.lastUpload, defaults)
 }
 
-func (u *storageControllerImpl[S]) UploadSnapshot(ctx context.Context, snapshot io.Reader, snapshotSize int64, timestamp time.Time, defaults StorageConfigDefaults) (bool, time.Time, error) {
-	frequency := u.config.frequencyOrDefault(defaults)
+func (u *storageControllerImpl[S]) UploadSnapshot(ctx context.Context, snapshot io.Reader, snapshotSize int64, timestamp time.Time, metadata SnapshotMetadata, defaults StorageConfigDefaults) (bool, time.Time, error) {
+	scheduledUpload, err := u.config.nextSnapshotOrDefault(u.lastUpload, defaults)
+	if err != nil {
+		return false, time.Time{}, err
+	}
 
-	if timestamp.Before(u.lastUpload.Add(frequency)) {
+	if timestamp.Before(scheduledUpload) {
 		nextSnapshot, err := u.ScheduleSnapshot(ctx, timestamp, defaults)
 		return false, nextSnapshot, err
 	}
 
+	nextSnapshot, err := u.config.nextSnapshotOrDefault(timestamp, defaults)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, u.config.timeoutOrDefault(defaults))
 	defer cancel()
 
-	nextSnapshot := timestamp.Add(frequency)
-
 	prefix := u.config.namePrefixOrDefault(defaults)
-	suffix := u.config.nameSuffixOrDefault(defaults)
+	suffix := u.snapshotSuffix(defaults)
 	ts := timestamp.Format(u.config.timestampFormatOrDefault(defaults))
 	snapshotName := strings.Join([]string{prefix, ts, suffix}, "")
+	if layout := u.config.layoutOrDefault(defaults); layout != "" {
+		snapshotName = path.Join(timestamp.Format(layout), snapshotName)
+	}
+
+	// the metadata of streamed snapshots is only known after they have been read completely
+	source, _ := snapshot.(metadataSource)
+
+	if compressionConfig := u.config.compressionOrDefault(defaults); compressionConfig != nil {
+		uncompressed := snapshot
+		compressed := newPipe(func(w io.Writer) error { return compressionConfig.Compress(w, uncompressed) })
+		defer compressed.Close()
+
+		snapshot = compressed
+		// the size of the compressed snapshot is unknown until it is completely compressed
+		snapshotSize = -1
+	}
+
+	if encryptionConfig := u.config.encryptionOrDefault(defaults); encryptionConfig != nil {
+		plain := snapshot
+		encrypted := newPipe(func(w io.Writer) error { return encryptionConfig.Encrypt(w, plain) })
+		defer encrypted.Close()
+
+		snapshot = encrypted
+		snapshotSize = encryption.EncryptedSize(snapshotSize)
+	}
 
-	if err := u.storage.uploadSnapshot(ctx, snapshotName, snapshot, snapshotSize); err != nil {
+	checksum := newChecksumReader(snapshot)
+	if err := u.storage.uploadSnapshot(ctx, snapshotName, checksum, snapshotSize); err != nil {
 		return false, nextSnapshot, err
 	}
 
 	u.lastUpload = timestamp
 
+	if source != nil {
+		metadata = source.metadata()
+	}
+
+	manifest := SnapshotManifest{
+		SnapshotMetadata: metadata,
+		Snapshot:         snapshotName,
+		Timestamp:        timestamp,
+		Size:             checksum.size,
+		SHA256:           checksum.checksum(),
+	}
+	if err := uploadManifest(ctx, u.storage, manifest); err != nil {
+		logging.Warn("Could not upload manifest of snapshot", "snapshot", snapshotName, "error", err)
+	}
+
 	return true, nextSnapshot, nil
 }
 
 func (u *storageControllerImpl[S]) DeleteObsoleteSnapshots(ctx context.Context, defaults StorageConfigDefaults) (int, error) {
 	retain := u.config.retainOrDefault(defaults)
-	if retain < 1 {
+	retention := u.config.retentionOrDefault(defaults)
+	maxAge := u.config.maxAgeOrDefault(defaults)
+	maxTotalSize := u.config.maxTotalSizeOrDefault(defaults)
+	if retain < 1 && retention.isZero() && maxAge <= 0 && maxTotalSize <= 0 {
 		return 0, nil
 	}
 
 	ctx, cancel := context.WithTimeout(ctx, u.config.timeoutOrDefault(defaults))
 	defer cancel()
 
-	snapshots, err := u.listSnapshots(ctx, u.config.namePrefixOrDefault(defaults), u.config.nameSuffixOrDefault(defaults))
+	snapshots, err := u.listSnapshots(ctx, defaults)
 	if err != nil {
 		return 0, err
 	}
 
-	if len(snapshots) <= retain {
-		return 0, err
-	}
+	retained := retainedSnapshots(snapshots, u.storage.getLastModifiedTime, retain, retention)
+	limitRetainedSnapshots(snapshots, retained, u.storage.getLastModifiedTime, u.storage.getSize, maxAge, maxTotalSize)
 
+	var manifests map[string]S
 	deleted := 0
-	for _, s := range snapshots[retain:] {
+	for i, s := range snapshots {
+		if retained[i] {
+			continue
+		}
+
 		if err := u.storage.deleteSnapshot(ctx, s); err != nil {
 			logging.Warn("Could not delete snapshot", "snapshot", s, "error", err)
-		} else {
-			deleted++
+			continue
+		}
+		deleted++
+
+		if manifests == nil {
+			manifests = u.listManifests(ctx, defaults)
+		}
+
+		if manifest, found := manifests[manifestName(u.storage.getName(s))]; found {
+			if err := u.storage.deleteSnapshot(ctx, manifest); err != nil {
+				logging.Warn("Could not delete manifest of snapshot", "snapshot", s, "error", err)
+			}
 		}
 	}
 
 	return deleted, nil
 }
 
-func (u *storageControllerImpl[S]) listSnapshots(ctx context.Context, prefix string, suffix string) ([]S, error) {
-	snapshots, err := u.storage.listSnapshots(ctx, prefix, suffix)
+// listManifests returns the manifests of the snapshots by their names
+func (u *storageControllerImpl[S]) listManifests(ctx context.Context, defaults StorageConfigDefaults) map[string]S {
+	manifests := map[string]S{}
+
+	list, err := u.listFiles(ctx, manifestSuffix, defaults)
+	if err != nil {
+		logging.Warn("Could not list manifests of snapshots", "error", err)
+		return manifests
+	}
+
+	for _, m := range list {
+		manifests[u.storage.getName(m)] = m
+	}
+
+	return manifests
+}
+
+func (u *storageControllerImpl[S]) ListSnapshots(ctx context.Context, defaults StorageConfigDefaults) ([]SnapshotInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, u.config.timeoutOrDefault(defaults))
+	defer cancel()
+
+	snapshots, err := u.listSnapshots(ctx, defaults)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]SnapshotInfo, 0, len(snapshots))
+	for _, s := range snapshots {
+		infos = append(infos, SnapshotInfo{
+			Name:         u.storage.getName(s),
+			Size:         u.storage.getSize(s),
+			LastModified: u.storage.getLastModifiedTime(s),
+		})
+	}
+
+	return infos, nil
+}
+
+func (u *storageControllerImpl[S]) DownloadSnapshot(ctx context.Context, name string, defaults StorageConfigDefaults) (io.ReadCloser, error) {
+	snapshot, err := u.findSnapshot(ctx, name, defaults)
+	if err != nil {
+		return nil, err
+	}
+
+	// the transformations are determined by the name, as the snapshot may have been written with another configuration
+	format, _ := matchSnapshotFormat(u.snapshotFormats(defaults), name)
+	encryptionConfig := u.config.encryptionOrDefault(defaults)
+	if format.encrypted && encryptionConfig == nil {
+		return nil, fmt.Errorf("snapshot %s is encrypted but no encryption is configured", name)
+	}
+
+	data, err := u.storage.downloadSnapshot(ctx, snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	if format.encrypted {
+		encrypted := data
+		data = &readCloser{
+			Reader: newPipe(func(w io.Writer) error { return encryptionConfig.Decrypt(w, encrypted) }),
+			close:  encrypted.Close,
+		}
+	}
+
+	if compressionConfig := format.compression; compressionConfig != nil {
+		compressed := data
+		data = &readCloser{
+			Reader: newPipe(func(w io.Writer) error { return compressionConfig.Decompress(w, compressed) }),
+			close:  compressed.Close,
+		}
+	}
+
+	return data, nil
+}
+
+func (u *storageControllerImpl[S]) findSnapshot(ctx context.Context, name string, defaults StorageConfigDefaults) (S, error) {
+	listCtx, cancel := context.WithTimeout(ctx, u.config.timeoutOrDefault(defaults))
+	defer cancel()
+
+	var none S
+	snapshots, err := u.listSnapshots(listCtx, defaults)
+	if err != nil {
+		return none, err
+	}
+
+	for _, s := range snapshots {
+		if u.storage.getName(s) == name {
+			return s, nil
+		}
+	}
+
+	return none, fmt.Errorf("snapshot %s not found", name)
+}
+
+// snapshotSuffix returns the suffix of the snapshot-names including the suffixes of any applied transformations
+func (u *storageControllerImpl[S]) snapshotSuffix(defaults StorageConfigDefaults) string {
+	suffix := u.config.nameSuffixOrDefault(defaults)
+	if compressionConfig := u.config.compressionOrDefault(defaults); compressionConfig != nil {
+		suffix += compressionConfig.NameSuffix()
+	}
+	if encryptionConfig := u.config.encryptionOrDefault(defaults); encryptionConfig != nil {
+		suffix += encryptionConfig.Suffix
+	}
+	return suffix
+}
+
+// snapshotFormat describes the transformations applied to the snapshots whose names end with the suffix
+type snapshotFormat struct {
+	suffix      string
+	compression *compression.CompressionConfig
+	encrypted   bool
+}
+
+// snapshotFormats returns the formats of the snapshots in the storage ordered by the length of their suffixes.
+// Besides the configured format these are the formats of all other compression-algorithms and of snapshots without
+// compression or encryption, so that snapshots written before the configuration changed are listed, too
+func (u *storageControllerImpl[S]) snapshotFormats(defaults StorageConfigDefaults) []snapshotFormat {
+	compressions := []*compression.CompressionConfig{u.config.compressionOrDefault(defaults)}
+	for _, algorithm := range compression.Algorithms {
+		compressions = append(compressions, &compression.CompressionConfig{Algorithm: algorithm})
+	}
+	compressions = append(compressions, nil)
+
+	encryptionSuffix := encryption.DefaultSuffix
+	if encryptionConfig := u.config.encryptionOrDefault(defaults); encryptionConfig != nil {
+		encryptionSuffix = encryptionConfig.Suffix
+	}
+
+	var formats []snapshotFormat
+	for _, compressionConfig := range compressions {
+		suffix := u.config.nameSuffixOrDefault(defaults)
+		if compressionConfig != nil {
+			suffix += compressionConfig.NameSuffix()
+		}
+		formats = append(formats,
+			snapshotFormat{suffix + encryptionSuffix, compressionConfig, true},
+			snapshotFormat{suffix, compressionConfig, false},
+		)
+	}
+
+	// the longest matching suffix determines the format; for suffixes of equal length the configured format wins
+	slices.SortStableFunc(formats, func(a, b snapshotFormat) int {
+		return len(b.suffix) - len(a.suffix)
+	})
+	return formats
+}
+
+// matchSnapshotFormat returns the first of the given formats whose suffix matches the name
+func matchSnapshotFormat(formats []snapshotFormat, name string) (snapshotFormat, bool) {
+	for _, format := range formats {
+		if strings.HasSuffix(name, format.suffix) {
+			return format, true
+		}
+	}
+	return snapshotFormat{}, false
+}
+
+// listSnapshots lists the snapshots in any of the snapshot-formats sorted by their modification time, newest first
+func (u *storageControllerImpl[S]) listSnapshots(ctx context.Context, defaults StorageConfigDefaults) ([]S, error) {
+	// the formats do not share a common suffix, so all files with the name-prefix are listed
+	snapshots, err := u.listFiles(ctx, "", defaults)
 	if err != nil {
 		return nil, err
 	}
 
+	formats := u.snapshotFormats(defaults)
+	snapshots = slices.DeleteFunc(snapshots, func(s S) bool {
+		name := u.storage.getName(s)
+		_, matches := matchSnapshotFormat(formats, name)
+		return isManifest(name) || !matches
+	})
+
 	slices.SortFunc(snapshots, func(a, b S) int {
 		return u.storage.getLastModifiedTime(a).Compare(u.storage.getLastModifiedTime(b)) * -1
 	})
@@ -114,6 +353,26 @@ func (u *storageControllerImpl[S]) listSnapshots(ctx context.Context, prefix str
 	return snapshots, nil
 }
 
+// listFiles lists the files with the configured name-prefix and the given suffix.
+// If a layout is configured, the files in sub-directories are listed, too, and the prefix is matched against the
+// names of the files without their directories
+func (u *storageControllerImpl[S]) listFiles(ctx context.Context, suffix string, defaults StorageConfigDefaults) ([]S, error) {
+	prefix := u.config.namePrefixOrDefault(defaults)
+	if u.config.layoutOrDefault(defaults) == "" {
+		return u.storage.listSnapshots(ctx, prefix, suffix, false)
+	}
+
+	files, err := u.storage.listSnapshots(ctx, "", suffix, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(files, func(f S) bool {
+		name := u.storage.getName(f)
+		return !strings.HasPrefix(path.Base(name), prefix) || !strings.HasSuffix(name, suffix)
+	}), nil
+}
+
 func (u *storageControllerImpl[S]) ensureLastUploadTime(ctx context.Context, lastSnapshotTime time.Time, defaults StorageConfigDefaults) error {
 	if u.lastUpload.IsZero() {
 		if !lastSnapshotTime.IsZero() {
@@ -133,7 +392,7 @@ func (u *storageControllerImpl[S]) getLastModificationTime(ctx context.Context,
 	ctx, cancel := context.WithTimeout(ctx, u.config.timeoutOrDefault(defaults))
 	defer cancel()
 
-	snapshots, err := u.storage.listSnapshots(ctx, u.config.namePrefixOrDefault(defaults), u.config.nameSuffixOrDefault(defaults))
+	snapshots, err := u.listSnapshots(ctx, defaults)
 	if err != nil {
 		return u.lastUpload, err
 	}
@@ -145,3 +404,34 @@ func (u *storageControllerImpl[S]) getLastModificationTime(ctx context.Context,
 	u.lastUpload = u.storage.getLastModifiedTime(snapshots[0])
 	return u.lastUpload, nil
 }
+
+// Close releases the resources of storages implementing io.Closer
+func (u *storageControllerImpl[S]) Close() error {
+	if closer, ok := u.storage.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// readCloser combines a reader with a function closing its underlying resources
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (r *readCloser) Close() error {
+	if closer, ok := r.Reader.(io.Closer); ok {
+		_ = closer.Close()
+	}
+	return r.close()
+}
+
+// newPipe returns a reader for the data written by the given function
+// Closing the reader before all data is read aborts the function
+func newPipe(write func(io.Writer) error) io.ReadCloser {
+	reader, writer := io.Pipe()
+	go func() {
+		_ = writer.CloseWithError(write(writer))
+	}()
+	return reader
+}
@@ -1,12 +1,26 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/compression"
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/config/secret"
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/encryption"
 	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/test"
 	"github.com/stretchr/testify/assert"
+	"github.com/thoas/go-funk"
 	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -44,6 +58,58 @@ func TestScheduleSnapshotFallsBackOnStorageConfigDefaults(t *testing.T) {
 	assert.Equal(t, lastUploadTime.Add(defaults.Frequency), nextSnapshot)
 }
 
+func TestScheduleSnapshotPrefersSchedule(t *testing.T) {
+	lastUploadTime := time.Date(2024, 1, 10, 2, 0, 0, 0, time.UTC)
+	config := StorageControllerConfig{
+		Frequency: time.Minute,
+		Schedule:  "CRON_TZ=UTC 0 2,14 * * *",
+	}
+
+	controller := &storageControllerImpl[time.Time]{
+		config:     config,
+		lastUpload: lastUploadTime,
+	}
+
+	nextSnapshot, err := controller.ScheduleSnapshot(context.Background(), time.Time{}, StorageConfigDefaults{})
+	assert.NoError(t, err, "ScheduleSnapshot failed unexpectedly")
+	assert.True(t, time.Date(2024, 1, 10, 14, 0, 0, 0, time.UTC).Equal(nextSnapshot))
+}
+
+func TestScheduleSnapshotPrefersFrequencyOverDefaultSchedule(t *testing.T) {
+	lastUploadTime := time.Date(2024, 1, 10, 2, 0, 0, 0, time.UTC)
+	config := StorageControllerConfig{
+		Frequency: time.Minute,
+	}
+	defaults := StorageConfigDefaults{
+		Frequency: time.Hour,
+		Schedule:  "CRON_TZ=UTC 0 2,14 * * *",
+	}
+
+	controller := &storageControllerImpl[time.Time]{
+		config:     config,
+		lastUpload: lastUploadTime,
+	}
+
+	nextSnapshot, err := controller.ScheduleSnapshot(context.Background(), time.Time{}, defaults)
+	assert.NoError(t, err, "ScheduleSnapshot failed unexpectedly")
+	assert.Equal(t, lastUploadTime.Add(config.Frequency), nextSnapshot)
+
+	controller.config = StorageControllerConfig{}
+	nextSnapshot, err = controller.ScheduleSnapshot(context.Background(), time.Time{}, defaults)
+	assert.NoError(t, err, "ScheduleSnapshot failed unexpectedly")
+	assert.True(t, time.Date(2024, 1, 10, 14, 0, 0, 0, time.UTC).Equal(nextSnapshot))
+}
+
+func TestScheduleSnapshotFailsForInvalidSchedule(t *testing.T) {
+	controller := &storageControllerImpl[time.Time]{
+		config:     StorageControllerConfig{Schedule: "invalid"},
+		lastUpload: time.Now(),
+	}
+
+	_, err := controller.ScheduleSnapshot(context.Background(), time.Time{}, StorageConfigDefaults{})
+	assert.Error(t, err)
+}
+
 func TestScheduleSnapshotFallsBackOnLastSnapshotTime(t *testing.T) {
 	lastSnapshotTime := time.Now()
 	config := StorageControllerConfig{
@@ -115,7 +181,7 @@ func TestUploadSnapshotUploadsToStorage(t *testing.T) {
 	data := "test"
 	timestamp := time.Now()
 	start := time.Now()
-	uploaded, nextSnapshot, err := controller.UploadSnapshot(ctx, strings.NewReader(data), 0, timestamp, StorageConfigDefaults{})
+	uploaded, nextSnapshot, err := controller.UploadSnapshot(ctx, strings.NewReader(data), 0, timestamp, SnapshotMetadata{}, StorageConfigDefaults{})
 	assert.NoError(t, err, "uploadSnapshot failed unexpectedly")
 
 	assert.True(t, uploaded)
@@ -129,6 +195,132 @@ func TestUploadSnapshotUploadsToStorage(t *testing.T) {
 	assert.Equal(t, data, storage.uploadData)
 }
 
+func TestUploadSnapshotUploadsIntoDirectoryOfLayout(t *testing.T) {
+	storage := &storageStub{}
+	controller := &storageControllerImpl[time.Time]{
+		config:  StorageControllerConfig{NamePrefix: "test-", NameSuffix: ".test", TimestampFormat: "15-04"},
+		storage: storage,
+	}
+
+	timestamp := time.Date(2024, 3, 10, 14, 30, 0, 0, time.UTC)
+	uploaded, _, err := controller.UploadSnapshot(context.Background(), strings.NewReader("test"), 0, timestamp, SnapshotMetadata{}, StorageConfigDefaults{Layout: "2006/01/02"})
+	assert.NoError(t, err, "uploadSnapshot failed unexpectedly")
+
+	assert.True(t, uploaded)
+	assert.Equal(t, "2024/03/10/test-14-30.test", storage.uploadName)
+	assert.Equal(t, manifestName("2024/03/10/test-14-30.test"), storage.manifestName)
+}
+
+func TestUploadSnapshotUploadsManifest(t *testing.T) {
+	storage := &storageStub{}
+	controller := &storageControllerImpl[time.Time]{
+		config:  StorageControllerConfig{NameSuffix: ".test"},
+		storage: storage,
+	}
+
+	metadata := SnapshotMetadata{
+		Node:         "http://node",
+		RaftIndex:    10,
+		RaftTerm:     2,
+		AgentVersion: "test-version",
+	}
+
+	data := "test"
+	timestamp := time.Now()
+	uploaded, _, err := controller.UploadSnapshot(context.Background(), strings.NewReader(data), int64(len(data)), timestamp, metadata, StorageConfigDefaults{})
+	assert.NoError(t, err, "uploadSnapshot failed unexpectedly")
+	assert.True(t, uploaded)
+
+	assert.Equal(t, storage.uploadName+".manifest.json", storage.manifestName)
+
+	manifest := SnapshotManifest{}
+	assert.NoError(t, json.Unmarshal([]byte(storage.manifestData), &manifest), "could not read uploaded manifest")
+
+	checksum := sha256.Sum256([]byte(data))
+	assert.Equal(t, metadata, manifest.SnapshotMetadata)
+	assert.Equal(t, storage.uploadName, manifest.Snapshot)
+	assert.True(t, timestamp.Equal(manifest.Timestamp))
+	assert.Equal(t, int64(len(data)), manifest.Size)
+	assert.Equal(t, hex.EncodeToString(checksum[:]), manifest.SHA256)
+}
+
+func TestUploadSnapshotEncryptsSnapshot(t *testing.T) {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+
+	encryptionConfig := &encryption.EncryptionConfig{
+		Key:    secret.FromString(base64.StdEncoding.EncodeToString(key)),
+		Suffix: ".enc",
+	}
+
+	config := StorageControllerConfig{
+		Frequency:  time.Minute,
+		NamePrefix: "test",
+		NameSuffix: ".test",
+	}
+
+	storage := &storageStub{}
+	controller := &storageControllerImpl[time.Time]{
+		config:  config,
+		storage: storage,
+	}
+
+	data := "test"
+	timestamp := time.Now()
+	uploaded, _, err := controller.UploadSnapshot(context.Background(), strings.NewReader(data), int64(len(data)), timestamp, SnapshotMetadata{}, StorageConfigDefaults{Encryption: encryptionConfig})
+	assert.NoError(t, err, "uploadSnapshot failed unexpectedly")
+	assert.True(t, uploaded)
+
+	assert.True(t, strings.HasSuffix(storage.uploadName, ".test.enc"))
+	assert.Equal(t, encryption.EncryptedSize(int64(len(data))), storage.uploadSize)
+	assert.NotEqual(t, data, storage.uploadData)
+
+	decrypted := &bytes.Buffer{}
+	err = encryptionConfig.Decrypt(decrypted, strings.NewReader(storage.uploadData))
+	assert.NoError(t, err, "could not decrypt uploaded snapshot")
+	assert.Equal(t, data, decrypted.String())
+}
+
+func TestUploadSnapshotCompressesSnapshotBeforeEncryption(t *testing.T) {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+
+	compressionConfig := &compression.CompressionConfig{Algorithm: compression.AlgorithmZstd}
+	encryptionConfig := &encryption.EncryptionConfig{
+		Key:    secret.FromString(base64.StdEncoding.EncodeToString(key)),
+		Suffix: ".enc",
+	}
+
+	config := StorageControllerConfig{
+		NameSuffix:  ".test",
+		Compression: compressionConfig,
+	}
+
+	storage := &storageStub{}
+	controller := &storageControllerImpl[time.Time]{
+		config:  config,
+		storage: storage,
+	}
+
+	data := strings.Repeat("test", 1000)
+	uploaded, _, err := controller.UploadSnapshot(context.Background(), strings.NewReader(data), int64(len(data)), time.Now(), SnapshotMetadata{}, StorageConfigDefaults{Encryption: encryptionConfig})
+	assert.NoError(t, err, "uploadSnapshot failed unexpectedly")
+	assert.True(t, uploaded)
+
+	assert.True(t, strings.HasSuffix(storage.uploadName, ".test.zst.enc"))
+	assert.Equal(t, int64(-1), storage.uploadSize)
+
+	decrypted := &bytes.Buffer{}
+	err = encryptionConfig.Decrypt(decrypted, strings.NewReader(storage.uploadData))
+	assert.NoError(t, err, "could not decrypt uploaded snapshot")
+	assert.Less(t, decrypted.Len(), len(data))
+
+	decompressed := &bytes.Buffer{}
+	err = compressionConfig.Decompress(decompressed, decrypted)
+	assert.NoError(t, err, "could not decompress uploaded snapshot")
+	assert.Equal(t, data, decompressed.String())
+}
+
 func TestUploadSnapshotHandlesStorageFailure(t *testing.T) {
 	config := StorageControllerConfig{
 		Frequency: time.Minute,
@@ -142,7 +334,7 @@ func TestUploadSnapshotHandlesStorageFailure(t *testing.T) {
 
 	ctx := context.Background()
 	timestamp := time.Now()
-	uploaded, nextSnapshot, err := controller.UploadSnapshot(ctx, strings.NewReader("test"), 0, timestamp, StorageConfigDefaults{})
+	uploaded, nextSnapshot, err := controller.UploadSnapshot(ctx, strings.NewReader("test"), 0, timestamp, SnapshotMetadata{}, StorageConfigDefaults{})
 
 	assert.False(t, uploaded)
 	assert.Error(t, err, "uploadSnapshot should return error if storage fails")
@@ -158,7 +350,8 @@ func TestDeletesObsoleteSnapshots(t *testing.T) {
 
 	now := time.Now()
 	storage := &storageStub{
-		snapshots: []time.Time{now.Add(time.Minute), now.Add(time.Second), now.Add(time.Hour), now.Add(time.Second * 2)},
+		snapshots:  []time.Time{now.Add(time.Minute), now.Add(time.Second), now.Add(time.Hour), now.Add(time.Second * 2)},
+		nameSuffix: config.NameSuffix,
 	}
 	controller := &storageControllerImpl[time.Time]{
 		config:  config,
@@ -171,7 +364,137 @@ func TestDeletesObsoleteSnapshots(t *testing.T) {
 	assert.Equal(t, 2, deleted)
 	assert.Equal(t, []time.Time{now.Add(time.Hour), now.Add(time.Minute)}, storage.snapshots)
 	assert.Equal(t, config.NamePrefix, storage.listPrefix)
-	assert.Equal(t, config.NameSuffix, storage.listSuffix)
+	// the suffixes are matched by the controller as the snapshot-formats do not share a common suffix
+	assert.Empty(t, storage.listSuffix)
+}
+
+func TestDeletesManifestsOfObsoleteSnapshots(t *testing.T) {
+	config := StorageControllerConfig{
+		Retain:     test.PtrTo(1),
+		NameSuffix: ".test",
+	}
+
+	now := time.Now()
+	storage := &storageStub{
+		snapshots:  []time.Time{now, now.Add(-time.Hour)},
+		nameSuffix: config.NameSuffix,
+	}
+	storage.manifests = map[time.Time]string{
+		now.Add(time.Millisecond):              manifestName(storage.getName(now)),
+		now.Add(-time.Hour + time.Millisecond): manifestName(storage.getName(now.Add(-time.Hour))),
+	}
+	controller := &storageControllerImpl[time.Time]{
+		config:  config,
+		storage: storage,
+	}
+
+	deleted, err := controller.DeleteObsoleteSnapshots(context.Background(), StorageConfigDefaults{})
+	assert.NoError(t, err, "DeleteObsoleteSnapshots failed unexpectedly")
+
+	assert.Equal(t, 1, deleted)
+	assert.Equal(t, []time.Time{now}, storage.snapshots)
+	assert.Equal(t, map[time.Time]string{now.Add(time.Millisecond): manifestName(storage.getName(now))}, storage.manifests)
+}
+
+func TestDeletesObsoleteSnapshotsAccordingToRetention(t *testing.T) {
+	config := StorageControllerConfig{
+		Retain:    test.PtrTo(1),
+		Retention: &RetentionConfig{Daily: 2},
+	}
+
+	now := time.Now()
+	storage := &storageStub{
+		snapshots: []time.Time{now.Add(-time.Minute), now, now.Add(-48 * time.Hour), now.Add(-24 * time.Hour), now.Add(-24*time.Hour - time.Minute)},
+	}
+	controller := &storageControllerImpl[time.Time]{
+		config:  config,
+		storage: storage,
+	}
+
+	deleted, err := controller.DeleteObsoleteSnapshots(context.Background(), StorageConfigDefaults{Retain: 5})
+	assert.NoError(t, err, "DeleteObsoleteSnapshots failed unexpectedly")
+
+	assert.Equal(t, 3, deleted)
+	assert.Equal(t, []time.Time{now, now.Add(-24 * time.Hour)}, storage.snapshots)
+}
+
+func TestDeleteObsoleteSnapshotsFallsBackOnDefaultRetention(t *testing.T) {
+	now := time.Now()
+	storage := &storageStub{
+		snapshots: []time.Time{now, now.Add(-24 * time.Hour), now.Add(-48 * time.Hour)},
+	}
+	controller := &storageControllerImpl[time.Time]{
+		config:  StorageControllerConfig{},
+		storage: storage,
+	}
+
+	deleted, err := controller.DeleteObsoleteSnapshots(context.Background(), StorageConfigDefaults{Retention: RetentionConfig{Daily: 2}})
+	assert.NoError(t, err, "DeleteObsoleteSnapshots failed unexpectedly")
+
+	assert.Equal(t, 1, deleted)
+	assert.Equal(t, []time.Time{now, now.Add(-24 * time.Hour)}, storage.snapshots)
+}
+
+func TestDeletesSnapshotsOlderThanMaxAge(t *testing.T) {
+	config := StorageControllerConfig{
+		MaxAge: 36 * time.Hour,
+	}
+
+	now := time.Now()
+	storage := &storageStub{
+		snapshots: []time.Time{now, now.Add(-24 * time.Hour), now.Add(-48 * time.Hour), now.Add(-72 * time.Hour)},
+	}
+	controller := &storageControllerImpl[time.Time]{
+		config:  config,
+		storage: storage,
+	}
+
+	deleted, err := controller.DeleteObsoleteSnapshots(context.Background(), StorageConfigDefaults{Retain: 3})
+	assert.NoError(t, err, "DeleteObsoleteSnapshots failed unexpectedly")
+
+	assert.Equal(t, 2, deleted)
+	assert.Equal(t, []time.Time{now, now.Add(-24 * time.Hour)}, storage.snapshots)
+}
+
+func TestDeletesOldestSnapshotsExceedingMaxTotalSize(t *testing.T) {
+	now := time.Now()
+	storage := &storageStub{
+		snapshots:    []time.Time{now, now.Add(-time.Hour), now.Add(-2 * time.Hour), now.Add(-3 * time.Hour)},
+		snapshotSize: 10,
+	}
+	controller := &storageControllerImpl[time.Time]{
+		config:  StorageControllerConfig{},
+		storage: storage,
+	}
+
+	deleted, err := controller.DeleteObsoleteSnapshots(context.Background(), StorageConfigDefaults{MaxTotalSize: 25})
+	assert.NoError(t, err, "DeleteObsoleteSnapshots failed unexpectedly")
+
+	assert.Equal(t, 2, deleted)
+	assert.Equal(t, []time.Time{now, now.Add(-time.Hour)}, storage.snapshots)
+}
+
+func TestDeleteObsoleteSnapshotsNeverDeletesNewestSnapshotBecauseOfLimits(t *testing.T) {
+	config := StorageControllerConfig{
+		MaxAge:       time.Hour,
+		MaxTotalSize: 5,
+	}
+
+	now := time.Now()
+	storage := &storageStub{
+		snapshots:    []time.Time{now.Add(-48 * time.Hour), now.Add(-72 * time.Hour)},
+		snapshotSize: 10,
+	}
+	controller := &storageControllerImpl[time.Time]{
+		config:  config,
+		storage: storage,
+	}
+
+	deleted, err := controller.DeleteObsoleteSnapshots(context.Background(), StorageConfigDefaults{})
+	assert.NoError(t, err, "DeleteObsoleteSnapshots failed unexpectedly")
+
+	assert.Equal(t, 1, deleted)
+	assert.Equal(t, []time.Time{now.Add(-48 * time.Hour)}, storage.snapshots)
 }
 
 func TestDeleteObsoleteSnapshotsIgnoresFailures(t *testing.T) {
@@ -263,7 +586,7 @@ func TestUploadSnapshotSkipsUploadBeforeScheduledTime(t *testing.T) {
 		storage:    storage,
 	}
 
-	uploaded, nextSnapshot, err := controller.UploadSnapshot(context.Background(), strings.NewReader("test"), 0, controller.lastUpload.Add(time.Second), StorageConfigDefaults{})
+	uploaded, nextSnapshot, err := controller.UploadSnapshot(context.Background(), strings.NewReader("test"), 0, controller.lastUpload.Add(time.Second), SnapshotMetadata{}, StorageConfigDefaults{})
 	assert.NoError(t, err, "uploadSnapshot failed unexpectedly")
 
 	assert.False(t, uploaded)
@@ -271,24 +594,318 @@ func TestUploadSnapshotSkipsUploadBeforeScheduledTime(t *testing.T) {
 	assert.Zero(t, storage.uploadContext)
 }
 
+func TestUploadSnapshotUploadsAtScheduledTime(t *testing.T) {
+	lastUploadTime := time.Date(2024, 1, 10, 2, 0, 0, 0, time.UTC)
+	config := StorageControllerConfig{
+		Schedule: "CRON_TZ=UTC 0 2,14 * * *",
+	}
+
+	storage := &storageStub{}
+	controller := &storageControllerImpl[time.Time]{
+		config:     config,
+		lastUpload: lastUploadTime,
+		storage:    storage,
+	}
+
+	uploaded, nextSnapshot, err := controller.UploadSnapshot(context.Background(), strings.NewReader("test"), 0, lastUploadTime.Add(time.Hour), SnapshotMetadata{}, StorageConfigDefaults{})
+	assert.NoError(t, err, "UploadSnapshot failed unexpectedly")
+	assert.False(t, uploaded)
+	assert.True(t, time.Date(2024, 1, 10, 14, 0, 0, 0, time.UTC).Equal(nextSnapshot))
+
+	timestamp := time.Date(2024, 1, 10, 14, 0, 1, 0, time.UTC)
+	uploaded, nextSnapshot, err = controller.UploadSnapshot(context.Background(), strings.NewReader("test"), 0, timestamp, SnapshotMetadata{}, StorageConfigDefaults{})
+	assert.NoError(t, err, "UploadSnapshot failed unexpectedly")
+	assert.True(t, uploaded)
+	assert.True(t, time.Date(2024, 1, 11, 2, 0, 0, 0, time.UTC).Equal(nextSnapshot))
+}
+
+func TestListSnapshotsListsNewestSnapshotsFirst(t *testing.T) {
+	config := StorageControllerConfig{
+		NamePrefix: "test",
+		NameSuffix: ".test",
+	}
+
+	now := time.Now()
+	storage := &storageStub{
+		snapshots:    []time.Time{now.Add(-time.Hour), now},
+		snapshotSize: 10,
+		nameSuffix:   config.NameSuffix,
+	}
+	controller := &storageControllerImpl[time.Time]{
+		config:  config,
+		storage: storage,
+	}
+
+	snapshots, err := controller.ListSnapshots(context.Background(), StorageConfigDefaults{})
+	assert.NoError(t, err, "ListSnapshots failed unexpectedly")
+
+	assert.Equal(t, []SnapshotInfo{
+		{Name: storage.getName(now), Size: 10, LastModified: now},
+		{Name: storage.getName(now.Add(-time.Hour)), Size: 10, LastModified: now.Add(-time.Hour)},
+	}, snapshots)
+	assert.Equal(t, config.NamePrefix, storage.listPrefix)
+}
+
+func TestListSnapshotsIgnoresManifests(t *testing.T) {
+	now := time.Now()
+	storage := &storageStub{
+		snapshots: []time.Time{now, now.Add(time.Millisecond)},
+	}
+	storage.manifests = map[time.Time]string{
+		now.Add(time.Millisecond): manifestName(storage.getName(now)),
+	}
+	controller := &storageControllerImpl[time.Time]{
+		config:  StorageControllerConfig{NameSuffix: ""},
+		storage: storage,
+	}
+
+	snapshots, err := controller.ListSnapshots(context.Background(), StorageConfigDefaults{})
+	assert.NoError(t, err, "ListSnapshots failed unexpectedly")
+
+	assert.Equal(t, []SnapshotInfo{{Name: storage.getName(now), LastModified: now}}, snapshots)
+}
+
+func TestListSnapshotsListsSubDirectoriesIfLayoutIsConfigured(t *testing.T) {
+	now := time.Now()
+	storage := &storageStub{
+		snapshots: []time.Time{now, now.Add(-time.Hour), now.Add(-2 * time.Hour), now.Add(-3 * time.Hour)},
+	}
+	storage.names = map[time.Time]string{
+		now:                     "2024/03/test-1.test",
+		now.Add(-time.Hour):     "2024/02/other-2.test",
+		now.Add(-2 * time.Hour): "2024/01/test-3.other",
+		now.Add(-3 * time.Hour): "test-4.test",
+	}
+	controller := &storageControllerImpl[time.Time]{
+		config:  StorageControllerConfig{NamePrefix: "test-", NameSuffix: ".test", Layout: "2006/01"},
+		storage: storage,
+	}
+
+	snapshots, err := controller.ListSnapshots(context.Background(), StorageConfigDefaults{})
+	assert.NoError(t, err, "ListSnapshots failed unexpectedly")
+
+	assert.True(t, storage.listRecursive)
+	assert.Empty(t, storage.listPrefix)
+	assert.Equal(t, []string{"2024/03/test-1.test", "test-4.test"}, funk.Map(snapshots, func(s SnapshotInfo) string { return s.Name }))
+}
+
+func TestDownloadSnapshotDownloadsSnapshotWithGivenName(t *testing.T) {
+	now := time.Now()
+	storage := &storageStub{
+		snapshots:    []time.Time{now, now.Add(-time.Hour)},
+		downloadData: "test",
+	}
+	controller := &storageControllerImpl[time.Time]{
+		config:  StorageControllerConfig{},
+		storage: storage,
+	}
+
+	data, err := controller.DownloadSnapshot(context.Background(), storage.getName(now.Add(-time.Hour)), StorageConfigDefaults{})
+	assert.NoError(t, err, "DownloadSnapshot failed unexpectedly")
+	defer data.Close()
+
+	downloaded, err := io.ReadAll(data)
+	assert.NoError(t, err, "reading snapshot failed unexpectedly")
+	assert.Equal(t, "test", string(downloaded))
+	assert.Equal(t, now.Add(-time.Hour), storage.downloaded)
+}
+
+func TestDownloadSnapshotDecryptsSnapshot(t *testing.T) {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+
+	encryptionConfig := &encryption.EncryptionConfig{
+		Key:    secret.FromString(base64.StdEncoding.EncodeToString(key)),
+		Suffix: ".enc",
+	}
+
+	encrypted := &bytes.Buffer{}
+	assert.NoError(t, encryptionConfig.Encrypt(encrypted, strings.NewReader("test")))
+
+	now := time.Now()
+	storage := &storageStub{
+		snapshots:    []time.Time{now},
+		downloadData: encrypted.String(),
+		nameSuffix:   ".enc",
+	}
+	controller := &storageControllerImpl[time.Time]{
+		config:  StorageControllerConfig{Encryption: encryptionConfig},
+		storage: storage,
+	}
+
+	data, err := controller.DownloadSnapshot(context.Background(), storage.getName(now), StorageConfigDefaults{})
+	assert.NoError(t, err, "DownloadSnapshot failed unexpectedly")
+	defer data.Close()
+
+	decrypted, err := io.ReadAll(data)
+	assert.NoError(t, err, "reading snapshot failed unexpectedly")
+	assert.Equal(t, "test", string(decrypted))
+}
+
+func TestDownloadSnapshotDecompressesSnapshot(t *testing.T) {
+	compressionConfig := &compression.CompressionConfig{Algorithm: compression.AlgorithmGzip}
+
+	compressed := &bytes.Buffer{}
+	assert.NoError(t, compressionConfig.Compress(compressed, strings.NewReader("test")))
+
+	now := time.Now()
+	storage := &storageStub{
+		snapshots:    []time.Time{now},
+		downloadData: compressed.String(),
+		nameSuffix:   ".test.gz",
+	}
+	controller := &storageControllerImpl[time.Time]{
+		config:  StorageControllerConfig{NameSuffix: ".test"},
+		storage: storage,
+	}
+
+	data, err := controller.DownloadSnapshot(context.Background(), storage.getName(now), StorageConfigDefaults{Compression: compressionConfig})
+	assert.NoError(t, err, "DownloadSnapshot failed unexpectedly")
+	defer data.Close()
+
+	decompressed, err := io.ReadAll(data)
+	assert.NoError(t, err, "reading snapshot failed unexpectedly")
+	assert.Equal(t, "test", string(decompressed))
+}
+
+func TestListSnapshotsListsSnapshotsOfAllFormats(t *testing.T) {
+	now := time.Now()
+	storage := &storageStub{
+		snapshots: []time.Time{now, now.Add(-time.Hour), now.Add(-2 * time.Hour), now.Add(-3 * time.Hour), now.Add(-4 * time.Hour)},
+	}
+	storage.names = map[time.Time]string{
+		now:                     "test-1.snap.zst.enc",
+		now.Add(-time.Hour):     "test-2.snap.gz",
+		now.Add(-2 * time.Hour): "test-3.snap",
+		now.Add(-3 * time.Hour): "test-4.snap.enc",
+		now.Add(-4 * time.Hour): "test-5.other",
+	}
+	controller := &storageControllerImpl[time.Time]{
+		config: StorageControllerConfig{
+			NameSuffix:  ".snap",
+			Compression: &compression.CompressionConfig{Algorithm: compression.AlgorithmXz},
+		},
+		storage: storage,
+	}
+
+	snapshots, err := controller.ListSnapshots(context.Background(), StorageConfigDefaults{})
+	assert.NoError(t, err, "ListSnapshots failed unexpectedly")
+
+	assert.Equal(t, []string{"test-1.snap.zst.enc", "test-2.snap.gz", "test-3.snap", "test-4.snap.enc"}, funk.Map(snapshots, func(s SnapshotInfo) string { return s.Name }))
+}
+
+func TestSnapshotsRemainAccessibleAfterCompressionChanged(t *testing.T) {
+	dir := t.TempDir()
+	defaults := StorageConfigDefaults{
+		NamePrefix:      "test-",
+		NameSuffix:      ".snap",
+		TimestampFormat: "2006-01-02T15-04-05",
+		Timeout:         time.Minute,
+	}
+	config := StorageControllerConfig{
+		Compression: &compression.CompressionConfig{Algorithm: compression.AlgorithmGzip},
+	}
+
+	first := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	controller := newStorageController[os.FileInfo](config, localStorageImpl{dir})
+	uploaded, _, err := controller.UploadSnapshot(context.Background(), strings.NewReader("gzip"), 4, first, SnapshotMetadata{}, defaults)
+	assert.NoError(t, err, "UploadSnapshot failed unexpectedly")
+	assert.True(t, uploaded)
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "test-2024-01-01T00-00-00.snap.gz"), first, first))
+
+	config.Compression = &compression.CompressionConfig{Algorithm: compression.AlgorithmZstd}
+	controller = newStorageController[os.FileInfo](config, localStorageImpl{dir})
+
+	snapshots, err := controller.ListSnapshots(context.Background(), defaults)
+	assert.NoError(t, err, "ListSnapshots failed unexpectedly")
+	assert.Equal(t, []string{"test-2024-01-01T00-00-00.snap.gz"}, funk.Map(snapshots, func(s SnapshotInfo) string { return s.Name }))
+
+	data, err := controller.DownloadSnapshot(context.Background(), snapshots[0].Name, defaults)
+	assert.NoError(t, err, "DownloadSnapshot failed unexpectedly")
+	downloaded, err := io.ReadAll(data)
+	assert.NoError(t, err, "reading snapshot failed unexpectedly")
+	assert.NoError(t, data.Close())
+	assert.Equal(t, "gzip", string(downloaded))
+
+	uploaded, _, err = controller.UploadSnapshot(context.Background(), strings.NewReader("zstd"), 4, first.Add(time.Hour), SnapshotMetadata{}, defaults)
+	assert.NoError(t, err, "UploadSnapshot failed unexpectedly")
+	assert.True(t, uploaded)
+
+	defaults.Retain = 1
+	deleted, err := controller.DeleteObsoleteSnapshots(context.Background(), defaults)
+	assert.NoError(t, err, "DeleteObsoleteSnapshots failed unexpectedly")
+	assert.Equal(t, 1, deleted)
+
+	snapshots, err = controller.ListSnapshots(context.Background(), defaults)
+	assert.NoError(t, err, "ListSnapshots failed unexpectedly")
+	assert.Equal(t, []string{"test-2024-01-01T01-00-00.snap.zst"}, funk.Map(snapshots, func(s SnapshotInfo) string { return s.Name }))
+}
+
+func TestDownloadSnapshotFailsForEncryptedSnapshotWithoutEncryption(t *testing.T) {
+	now := time.Now()
+	storage := &storageStub{
+		snapshots:  []time.Time{now},
+		nameSuffix: ".snap.enc",
+	}
+	controller := &storageControllerImpl[time.Time]{
+		config:  StorageControllerConfig{NameSuffix: ".snap"},
+		storage: storage,
+	}
+
+	_, err := controller.DownloadSnapshot(context.Background(), storage.getName(now), StorageConfigDefaults{})
+	assert.ErrorContains(t, err, "encrypted")
+	assert.True(t, storage.downloaded.IsZero(), "encrypted snapshot should not be downloaded")
+}
+
+func TestDownloadSnapshotFailsForUnknownSnapshot(t *testing.T) {
+	storage := &storageStub{
+		snapshots: []time.Time{time.Now()},
+	}
+	controller := &storageControllerImpl[time.Time]{
+		config:  StorageControllerConfig{},
+		storage: storage,
+	}
+
+	_, err := controller.DownloadSnapshot(context.Background(), "unknown", StorageConfigDefaults{})
+	assert.ErrorContains(t, err, "unknown")
+}
+
 type storageStub struct {
 	snapshots      []time.Time
 	uploadContext  context.Context
 	uploadFails    bool
 	uploadName     string
 	uploadData     string
+	uploadSize     int64
 	deleteFailures []time.Time
 	listFails      bool
 	listPrefix     string
 	listSuffix     string
+	listRecursive  bool
 	deleted        bool
+	snapshotSize   int64
+	downloadData   string
+	downloaded     time.Time
+	manifests      map[time.Time]string
+	manifestName   string
+	manifestData   string
+	names          map[time.Time]string
+	nameSuffix     string
 }
 
 // nolint:unused
 // implements interface storage
-func (stub *storageStub) uploadSnapshot(ctx context.Context, name string, data io.Reader, _ int64) error {
+func (stub *storageStub) uploadSnapshot(ctx context.Context, name string, data io.Reader, size int64) error {
+	if isManifest(name) {
+		manifest, err := io.ReadAll(data)
+		stub.manifestName = name
+		stub.manifestData = string(manifest)
+		return err
+	}
+
 	stub.uploadContext = ctx
 	stub.uploadName = name
+	stub.uploadSize = size
 	upload, err := io.ReadAll(data)
 	if err != nil {
 		return err
@@ -310,22 +927,27 @@ func (stub *storageStub) deleteSnapshot(_ context.Context, snapshot time.Time) e
 		}
 	}
 
-	n := 0
+	var remaining []time.Time
 	for _, s := range stub.snapshots {
 		if s != snapshot {
-			stub.snapshots[n] = s
-			n++
+			remaining = append(remaining, s)
 		}
 	}
-	stub.snapshots = stub.snapshots[:n]
+	stub.snapshots = remaining
+	delete(stub.manifests, snapshot)
 	return nil
 }
 
 // nolint:unused
 // implements interface storage
-func (stub *storageStub) listSnapshots(_ context.Context, prefix string, suffix string) ([]time.Time, error) {
+func (stub *storageStub) listSnapshots(_ context.Context, prefix string, suffix string, recursive bool) ([]time.Time, error) {
+	if isManifest(suffix) {
+		return slices.Collect(maps.Keys(stub.manifests)), nil
+	}
+
 	stub.listPrefix = prefix
 	stub.listSuffix = suffix
+	stub.listRecursive = recursive
 
 	if stub.listFails {
 		return nil, errors.New("listing failed")
@@ -334,8 +956,33 @@ func (stub *storageStub) listSnapshots(_ context.Context, prefix string, suffix
 	return stub.snapshots, nil
 }
 
+// nolint:unused
+// implements interface storage
+func (stub *storageStub) downloadSnapshot(_ context.Context, snapshot time.Time) (io.ReadCloser, error) {
+	stub.downloaded = snapshot
+	return io.NopCloser(strings.NewReader(stub.downloadData)), nil
+}
+
+// nolint:unused
+// implements interface storage
+func (stub *storageStub) getName(snapshot time.Time) string {
+	if name, ok := stub.manifests[snapshot]; ok {
+		return name
+	}
+	if name, ok := stub.names[snapshot]; ok {
+		return name
+	}
+	return snapshot.Format(time.RFC3339Nano) + stub.nameSuffix
+}
+
 // nolint:unused
 // implements interface storage
 func (stub *storageStub) getLastModifiedTime(snapshot time.Time) time.Time {
 	return snapshot
 }
+
+// nolint:unused
+// implements interface storage
+func (stub *storageStub) getSize(_ time.Time) int64 {
+	return stub.snapshotSize
+}
@@ -21,7 +21,7 @@ type gcpStorageImpl struct {
 }
 
 func (conf GCPStorageConfig) Destination() string {
-	return fmt.Sprintf("gcp bucket %s", conf.Bucket)
+	return conf.describeDestination(fmt.Sprintf("gcp bucket %s", conf.Bucket))
 }
 
 func (conf GCPStorageConfig) CreateController(ctx context.Context) (StorageController, error) {
@@ -66,7 +66,7 @@ func (u gcpStorageImpl) deleteSnapshot(ctx context.Context, snapshot gcpStorage.
 
 // nolint:unused
 // implements interface storage
-func (u gcpStorageImpl) listSnapshots(ctx context.Context, prefix string, _ string) ([]gcpStorage.ObjectAttrs, error) {
+func (u gcpStorageImpl) listSnapshots(ctx context.Context, prefix string, _ string, _ bool) ([]gcpStorage.ObjectAttrs, error) {
 	var result []gcpStorage.ObjectAttrs
 
 	query := &gcpStorage.Query{Prefix: prefix}
@@ -86,8 +86,26 @@ func (u gcpStorageImpl) listSnapshots(ctx context.Context, prefix string, _ stri
 	return result, nil
 }
 
+// nolint:unused
+// implements interface storage
+func (u gcpStorageImpl) downloadSnapshot(ctx context.Context, snapshot gcpStorage.ObjectAttrs) (io.ReadCloser, error) {
+	return u.bucket.Object(snapshot.Name).NewReader(ctx)
+}
+
+// nolint:unused
+// implements interface storage
+func (u gcpStorageImpl) getName(snapshot gcpStorage.ObjectAttrs) string {
+	return snapshot.Name
+}
+
 // nolint:unused
 // implements interface storage
 func (u gcpStorageImpl) getLastModifiedTime(snapshot gcpStorage.ObjectAttrs) time.Time {
 	return snapshot.Updated
 }
+
+// nolint:unused
+// implements interface storage
+func (u gcpStorageImpl) getSize(snapshot gcpStorage.ObjectAttrs) int64 {
+	return snapshot.Size
+}
@@ -0,0 +1,27 @@
+package storage
+
+import (
+	"os"
+	"path"
+)
+
+// nestedFileInfo describes a file in a sub-directory of a storage-location.
+// Its name is the path of the file relative to the storage-location
+type nestedFileInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (f nestedFileInfo) Name() string {
+	return f.name
+}
+
+// deleteEmptyParents deletes the parent-directories of the file with the given name up to the storage-location.
+// It stops at the first directory which could not be deleted, e.g. because it is not empty
+func deleteEmptyParents(name string, deleteDirectory func(dir string) error) {
+	for dir := path.Dir(name); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if deleteDirectory(dir) != nil {
+			return
+		}
+	}
+}
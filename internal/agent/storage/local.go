@@ -3,9 +3,13 @@ package storage
 import (
 	"context"
 	"fmt"
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/logging"
 	"go.uber.org/multierr"
 	"io"
+	"io/fs"
 	"os"
+	"path"
+	"path/filepath"
 	"strings"
 	"time"
 )
@@ -19,8 +23,15 @@ type localStorageImpl struct {
 	path string
 }
 
+// tempFileSuffix is appended to the hidden name of the temporary file a snapshot is written to
+// by the local and the sftp storage before it is renamed to its final name
+const tempFileSuffix = ".partial"
+
+// staleTempFileAge is the time after its last modification after which a temporary file is considered stale
+const staleTempFileAge = time.Hour
+
 func (conf LocalStorageConfig) Destination() string {
-	return fmt.Sprintf("local path %s", conf.Path)
+	return conf.describeDestination(fmt.Sprintf("local path %s", conf.Path))
 }
 
 func (conf LocalStorageConfig) CreateController(context.Context) (StorageController, error) {
@@ -32,28 +43,140 @@ func (conf LocalStorageConfig) CreateController(context.Context) (StorageControl
 	), nil
 }
 
-func (u localStorageImpl) uploadSnapshot(_ context.Context, name string, data io.Reader, _ int64) error {
-	fileName := fmt.Sprintf("%s/%s", u.path, name)
+// removeStaleData removes the temporary files of uploads which were interrupted, e.g. because the agent crashed
+// implements interface staleDataRemover
+func (conf LocalStorageConfig) removeStaleData() {
+	removeStaleTempFiles(conf.Path, time.Now().Add(-staleTempFileAge))
+}
+
+// removeStaleTempFiles removes the temporary files in the given path and its sub-directories
+// which have not been modified since the given time, e.g. because the agent crashed while writing them
+func removeStaleTempFiles(root string, modifiedBefore time.Time) {
+	err := filepath.WalkDir(root, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || !isTempFile(entry.Name()) {
+			return err
+		}
+
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(modifiedBefore) {
+			return err
+		}
+
+		logging.Info("Removing stale temporary file", "file", file)
+		if err := os.Remove(file); err != nil {
+			logging.Warn("Could not remove stale temporary file", "file", file, "error", err)
+		}
+		return nil
+	})
+
+	if err != nil {
+		logging.Warn("Could not remove stale temporary files", "path", root, "error", err)
+	}
+}
+
+// isTempFile returns true if the name is the name of a temporary file written by an upload
+func isTempFile(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, tempFileSuffix)
+}
+
+// uploadSnapshot writes the snapshot to a hidden temporary file which is renamed to the snapshot's name
+// after the data has been synced to disk, so that an interrupted upload never leaves a truncated snapshot
+func (u localStorageImpl) uploadSnapshot(_ context.Context, name string, data io.Reader, size int64) error {
+	fileName := filepath.Join(u.path, filepath.FromSlash(name))
+	dir := filepath.Dir(fileName)
+
+	if path.Dir(name) != "." {
+		if err := createDirectories(dir); err != nil {
+			return err
+		}
+	}
+
+	tempFileName := filepath.Join(dir, "."+filepath.Base(fileName)+tempFileSuffix)
+	if err := writeFile(tempFileName, data, size); err != nil {
+		_ = os.Remove(tempFileName)
+		return err
+	}
+
+	if err := os.Rename(tempFileName, fileName); err != nil {
+		_ = os.Remove(tempFileName)
+		return err
+	}
+
+	return syncDirectory(dir)
+}
+
+// createDirectories creates the given directory and its missing parents
+// and syncs the entries of the new directories to disk, so that they survive a crash like the snapshot
+func createDirectories(dir string) error {
+	var created []string
+	for parent := dir; parent != filepath.Dir(parent); parent = filepath.Dir(parent) {
+		if _, err := os.Stat(parent); err == nil {
+			break
+		}
+		created = append(created, parent)
+	}
+
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return err
+	}
+
+	// the entry of each new directory is contained in its parent
+	for _, created := range created {
+		if err := syncDirectory(filepath.Dir(created)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
 
-	file, err := os.Create(fileName)
+// writeFile writes the data to the file with the given name and syncs it to disk.
+// If size is not negative, writeFile fails if the number of bytes written does not match size
+func writeFile(name string, data io.Reader, size int64) error {
+	file, err := os.Create(name)
 	if err != nil {
 		return err
 	}
 
-	_, err = io.Copy(file, data)
+	written, err := io.Copy(file, data)
+	if err == nil && size >= 0 && written != size {
+		err = fmt.Errorf("incomplete write of %s: wrote %d of %d bytes", name, written, size)
+	}
+
+	if err == nil {
+		err = file.Sync()
+	}
 
 	return multierr.Append(err, file.Close())
 }
 
+// syncDirectory syncs the directory-entries of the given directory to disk
+func syncDirectory(name string) error {
+	dir, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+
+	return multierr.Append(dir.Sync(), dir.Close())
+}
+
 func (u localStorageImpl) deleteSnapshot(_ context.Context, snapshot os.FileInfo) error {
 	if err := os.Remove(fmt.Sprintf("%s/%s", u.path, snapshot.Name())); err != nil {
 		return err
 	}
 
+	deleteEmptyParents(snapshot.Name(), func(dir string) error {
+		return os.Remove(fmt.Sprintf("%s/%s", u.path, dir))
+	})
+
 	return nil
 }
 
-func (u localStorageImpl) listSnapshots(_ context.Context, prefix string, ext string) ([]os.FileInfo, error) {
+func (u localStorageImpl) listSnapshots(_ context.Context, prefix string, ext string, recursive bool) ([]os.FileInfo, error) {
+	if recursive {
+		return u.walkSnapshots(prefix, ext)
+	}
+
 	var snapshots []os.FileInfo
 
 	files, err := os.ReadDir(u.path)
@@ -62,7 +185,7 @@ func (u localStorageImpl) listSnapshots(_ context.Context, prefix string, ext st
 	}
 
 	for _, file := range files {
-		if strings.HasPrefix(file.Name(), prefix) && strings.HasSuffix(file.Name(), ext) {
+		if strings.HasPrefix(file.Name(), prefix) && strings.HasSuffix(file.Name(), ext) && !isTempFile(file.Name()) {
 			info, err := file.Info()
 			if err != nil {
 				return snapshots, err
@@ -74,6 +197,48 @@ func (u localStorageImpl) listSnapshots(_ context.Context, prefix string, ext st
 	return snapshots, nil
 }
 
+// walkSnapshots lists the snapshots in the path and its sub-directories
+func (u localStorageImpl) walkSnapshots(prefix string, ext string) ([]os.FileInfo, error) {
+	var snapshots []os.FileInfo
+
+	err := filepath.WalkDir(u.path, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), prefix) || !strings.HasSuffix(entry.Name(), ext) || isTempFile(entry.Name()) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		name, err := filepath.Rel(u.path, file)
+		if err != nil {
+			return err
+		}
+
+		snapshots = append(snapshots, nestedFileInfo{info, filepath.ToSlash(name)})
+		return nil
+	})
+
+	return snapshots, err
+}
+
+func (u localStorageImpl) downloadSnapshot(_ context.Context, snapshot os.FileInfo) (io.ReadCloser, error) {
+	return os.Open(fmt.Sprintf("%s/%s", u.path, snapshot.Name()))
+}
+
+func (u localStorageImpl) getName(snapshot os.FileInfo) string {
+	return snapshot.Name()
+}
+
 func (u localStorageImpl) getLastModifiedTime(snapshot os.FileInfo) time.Time {
 	return snapshot.ModTime()
 }
+
+func (u localStorageImpl) getSize(snapshot os.FileInfo) int64 {
+	return snapshot.Size()
+}
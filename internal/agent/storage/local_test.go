@@ -3,13 +3,17 @@ package storage
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/thoas/go-funk"
+	"io"
 	"math/rand"
 	"os"
 	"path/filepath"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 func TestLocalUploadSnapshotFailsIfFileCannotBeCreated(t *testing.T) {
@@ -24,7 +28,7 @@ func TestLocalUploadeSnapshotCreatesFile(t *testing.T) {
 	impl := localStorageImpl{t.TempDir()}
 	snapshotData := []byte("test")
 
-	err := impl.uploadSnapshot(context.Background(), "test.snap", bytes.NewReader(snapshotData), 0)
+	err := impl.uploadSnapshot(context.Background(), "test.snap", bytes.NewReader(snapshotData), int64(len(snapshotData)))
 
 	assert.NoError(t, err, "uploadSnapshot() failed unexpectedly!")
 
@@ -34,6 +38,68 @@ func TestLocalUploadeSnapshotCreatesFile(t *testing.T) {
 	assert.Equal(t, snapshotData, backupData)
 }
 
+func TestLocalUploadSnapshotFailsForIncompleteData(t *testing.T) {
+	impl := localStorageImpl{t.TempDir()}
+
+	err := impl.uploadSnapshot(context.Background(), "test.snap", bytes.NewReader([]byte("test")), 5)
+	assert.Error(t, err, "uploadSnapshot() should fail if size does not match")
+
+	files, err := os.ReadDir(impl.path)
+	assert.NoError(t, err)
+	assert.Empty(t, files, "neither snapshot nor temporary file should remain")
+}
+
+func TestLocalUploadSnapshotDoesNotReplaceSnapshotIfUploadFails(t *testing.T) {
+	impl := localStorageImpl{t.TempDir()}
+	snapshotData := []byte("test")
+
+	err := impl.uploadSnapshot(context.Background(), "test.snap", bytes.NewReader(snapshotData), int64(len(snapshotData)))
+	assert.NoError(t, err, "uploadSnapshot() failed unexpectedly!")
+
+	err = impl.uploadSnapshot(context.Background(), "test.snap", iotest.ErrReader(errors.New("read failed")), -1)
+	assert.Error(t, err, "uploadSnapshot() should fail if data could not be read")
+
+	backupData, err := os.ReadFile(fmt.Sprintf("%s/test.snap", impl.path))
+	assert.NoError(t, err, "could not read uploaded snapshot")
+	assert.Equal(t, snapshotData, backupData)
+}
+
+func TestLocalListSnapshotsIgnoresTempFiles(t *testing.T) {
+	impl := localStorageImpl{t.TempDir()}
+	assert.NoError(t, os.WriteFile(fmt.Sprintf("%s/.test.snap%s", impl.path, tempFileSuffix), []byte("test"), 0600))
+
+	for _, recursive := range []bool{false, true} {
+		snapshots, err := impl.listSnapshots(context.Background(), "", "", recursive)
+		assert.NoError(t, err, "listSnapshots() failed unexpectedly!")
+		assert.Empty(t, snapshots)
+	}
+}
+
+func TestRemoveStaleTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.Mkdir(fmt.Sprintf("%s/nested", dir), 0700))
+
+	stale := fmt.Sprintf("%s/nested/.stale.snap%s", dir, tempFileSuffix)
+	recent := fmt.Sprintf("%s/.recent.snap%s", dir, tempFileSuffix)
+	snapshot := fmt.Sprintf("%s/old.snap", dir)
+	for _, file := range []string{stale, recent, snapshot} {
+		assert.NoError(t, os.WriteFile(file, []byte("test"), 0600))
+	}
+
+	old := time.Now().Add(-2 * staleTempFileAge)
+	assert.NoError(t, os.Chtimes(stale, old, old))
+	assert.NoError(t, os.Chtimes(snapshot, old, old))
+
+	removeStaleTempFiles(dir, time.Now().Add(-staleTempFileAge))
+
+	_, err := os.Stat(stale)
+	assert.ErrorIs(t, err, os.ErrNotExist, "stale temporary file should have been removed")
+	_, err = os.Stat(recent)
+	assert.NoError(t, err, "recent temporary file should not have been removed")
+	_, err = os.Stat(snapshot)
+	assert.NoError(t, err, "snapshot should not have been removed")
+}
+
 func TestLocalDeleteSnapshot(t *testing.T) {
 	impl := localStorageImpl{t.TempDir()}
 	snapshotData := []byte("test")
@@ -42,7 +108,7 @@ func TestLocalDeleteSnapshot(t *testing.T) {
 		_ = os.RemoveAll(filepath.Dir(impl.path))
 	}()
 
-	err := impl.uploadSnapshot(context.Background(), "test.snap", bytes.NewReader(snapshotData), 0)
+	err := impl.uploadSnapshot(context.Background(), "test.snap", bytes.NewReader(snapshotData), int64(len(snapshotData)))
 	assert.NoError(t, err, "uploadSnapshot() failed unexpectedly!")
 
 	info, err := os.Stat(fmt.Sprintf("%s/test.snap", impl.path))
@@ -64,7 +130,7 @@ func TestLocalListSnapshots(t *testing.T) {
 		expectedSnaphotNames = append(expectedSnaphotNames, createEmptySnapshot(t, impl.path, "test", ".snap").Name())
 	}
 
-	listedSnapshots, err := impl.listSnapshots(context.Background(), "test", ".snap")
+	listedSnapshots, err := impl.listSnapshots(context.Background(), "test", ".snap", false)
 	listedSnapshotNames := funk.Map(listedSnapshots, func(s os.FileInfo) string { return s.Name() })
 
 	assert.NoError(t, err)
@@ -72,6 +138,68 @@ func TestLocalListSnapshots(t *testing.T) {
 	assert.ElementsMatch(t, expectedSnaphotNames, listedSnapshotNames)
 }
 
+func TestLocalListSnapshotsRecursively(t *testing.T) {
+	impl := localStorageImpl{t.TempDir()}
+	nested := fmt.Sprintf("%s/2024/01", impl.path)
+	assert.NoError(t, os.MkdirAll(nested, 0700))
+
+	expectedSnapshotNames := []string{
+		createEmptySnapshot(t, impl.path, "test", ".snap").Name(),
+		"2024/01/" + createEmptySnapshot(t, nested, "test", ".snap").Name(),
+	}
+	createEmptySnapshot(t, nested, "other", ".snap")
+
+	listedSnapshots, err := impl.listSnapshots(context.Background(), "test", ".snap", true)
+	assert.NoError(t, err, "listSnapshots() failed unexpectedly!")
+
+	listedSnapshotNames := funk.Map(listedSnapshots, func(s os.FileInfo) string { return impl.getName(s) })
+	assert.ElementsMatch(t, expectedSnapshotNames, listedSnapshotNames)
+}
+
+func TestLocalUploadAndDeleteSnapshotInSubDirectory(t *testing.T) {
+	impl := localStorageImpl{t.TempDir()}
+
+	err := impl.uploadSnapshot(context.Background(), "2024/01/02/test.snap", bytes.NewReader([]byte("test")), 4)
+	assert.NoError(t, err, "uploadSnapshot() failed unexpectedly!")
+	err = impl.uploadSnapshot(context.Background(), "2024/01/03/test.snap", bytes.NewReader([]byte("test")), 4)
+	assert.NoError(t, err, "uploadSnapshot() failed unexpectedly!")
+
+	snapshots, err := impl.listSnapshots(context.Background(), "test", ".snap", true)
+	assert.NoError(t, err, "listSnapshots() failed unexpectedly!")
+	assert.Len(t, snapshots, 2)
+
+	for _, snapshot := range snapshots {
+		if impl.getName(snapshot) == "2024/01/02/test.snap" {
+			assert.NoError(t, impl.deleteSnapshot(context.Background(), snapshot), "deleteSnapshot() failed unexpectedly!")
+		}
+	}
+
+	_, err = os.Stat(fmt.Sprintf("%s/2024/01/02", impl.path))
+	assert.ErrorIs(t, err, os.ErrNotExist, "empty directory should have been deleted")
+	_, err = os.Stat(fmt.Sprintf("%s/2024/01/03/test.snap", impl.path))
+	assert.NoError(t, err, "other snapshot should not have been deleted")
+}
+
+func TestLocalDownloadSnapshot(t *testing.T) {
+	impl := localStorageImpl{t.TempDir()}
+	snapshotData := []byte("test")
+
+	err := impl.uploadSnapshot(context.Background(), "test.snap", bytes.NewReader(snapshotData), int64(len(snapshotData)))
+	assert.NoError(t, err, "uploadSnapshot() failed unexpectedly!")
+
+	info, err := os.Stat(fmt.Sprintf("%s/test.snap", impl.path))
+	assert.NoError(t, err, "could not get info for snapshot: %v", err)
+	assert.Equal(t, "test.snap", impl.getName(info))
+
+	reader, err := impl.downloadSnapshot(context.Background(), info)
+	assert.NoError(t, err, "downloadSnapshot() failed unexpectedly!")
+	defer reader.Close()
+
+	downloadedData, err := io.ReadAll(reader)
+	assert.NoError(t, err, "could not read downloaded snapshot")
+	assert.Equal(t, snapshotData, downloadedData)
+}
+
 func TestLocalGetLastModifiedTime(t *testing.T) {
 	impl := localStorageImpl{t.TempDir()}
 
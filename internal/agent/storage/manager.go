@@ -5,13 +5,16 @@ import (
 	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/logging"
 	"go.uber.org/multierr"
 	"io"
+	"sync"
 	"time"
 )
 
 // Manager manages the upload of a snapshot to one or multiple storage-locations
 // using StorageController-instances configured by StoragesConfig
 type Manager struct {
-	factories []StorageControllerFactory
+	factories   []StorageControllerFactory
+	concurrency int
+	onRetry     func(destination string)
 }
 
 type StorageControllerFactory interface {
@@ -31,45 +34,77 @@ type StorageController interface {
 	ScheduleSnapshot(ctx context.Context, lastSnapshot time.Time, defaults StorageConfigDefaults) (time.Time, error)
 	// UploadSnapshot uploads the given snapshot to the controlled storage, if the timestamp of the snapshot
 	// corresponds with its scheduled upload-date.
+	// The given metadata is recorded in the manifest uploaded alongside the snapshot.
 	// For the case that the StorageControllerConfig of the controller does not specify one of its fields,
 	// StorageConfigDefaults is passed.
-	UploadSnapshot(ctx context.Context, snapshot io.Reader, snapshotSize int64, timestamp time.Time, defaults StorageConfigDefaults) (bool, time.Time, error)
+	UploadSnapshot(ctx context.Context, snapshot io.Reader, snapshotSize int64, timestamp time.Time, metadata SnapshotMetadata, defaults StorageConfigDefaults) (bool, time.Time, error)
 	DeleteObsoleteSnapshots(ctx context.Context, defaults StorageConfigDefaults) (int, error)
+	// ListSnapshots lists the snapshots in the controlled storage sorted from newest to oldest.
+	// For the case that the StorageControllerConfig of the controller does not specify one of its fields,
+	// StorageConfigDefaults is passed.
+	ListSnapshots(ctx context.Context, defaults StorageConfigDefaults) ([]SnapshotInfo, error)
+	// DownloadSnapshot returns the contents of the snapshot with the given name.
+	// If encryption is configured, the snapshot is decrypted.
+	// For the case that the StorageControllerConfig of the controller does not specify one of its fields,
+	// StorageConfigDefaults is passed.
+	DownloadSnapshot(ctx context.Context, name string, defaults StorageConfigDefaults) (io.ReadCloser, error)
+	// Close releases resources like connections held by the controller.
+	// Snapshots returned by DownloadSnapshot must be closed before
+	Close() error
+}
+
+// SnapshotInfo describes a snapshot stored in a storage
+type SnapshotInfo struct {
+	Name         string    `json:"name"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// StoredSnapshot describes a snapshot stored in one of the storages managed by the Manager
+type StoredSnapshot struct {
+	SnapshotInfo
+	Destination string `json:"destination"`
 }
 
 // CreateManager creates a Manager controlling the StorageController-instances
 // configured according to the given StoragesConfig and StorageConfigDefaults
 func CreateManager(storageConfig StoragesConfig) *Manager {
-	manager := &Manager{}
+	manager := &Manager{concurrency: storageConfig.Concurrency}
 
-	if storageConfig.AWS != nil {
-		manager.AddStorageFactory(storageConfig.AWS)
-	}
-	if storageConfig.Azure != nil {
-		manager.AddStorageFactory(storageConfig.Azure)
-	}
-	if storageConfig.GCP != nil {
-		manager.AddStorageFactory(storageConfig.GCP)
-	}
-	if storageConfig.Local != nil {
-		manager.AddStorageFactory(storageConfig.Local)
-	}
-	if storageConfig.Swift != nil {
-		manager.AddStorageFactory(storageConfig.Swift)
-	}
-	if storageConfig.S3 != nil {
-		manager.AddStorageFactory(storageConfig.S3)
+	for _, f := range storageConfig.factories() {
+		manager.AddStorageFactory(f.factory)
 	}
 
 	return manager
 }
 
+// staleDataRemover is implemented by the factories of storages which may contain stale data
+// left by uploads that were interrupted, e.g. because the agent crashed
+type staleDataRemover interface {
+	removeStaleData()
+}
+
+// RemoveStaleData removes the stale data left by interrupted uploads from the storages.
+// It is called once when the agent starts, so that the storages are not modified by the commands of the cli
+func (m *Manager) RemoveStaleData() {
+	for _, factory := range m.factories {
+		if remover, ok := factory.(staleDataRemover); ok {
+			remover.removeStaleData()
+		}
+	}
+}
+
 // AddStorageFactory adds a StorageController to the manager
 // Allows adding of StorageController-implementations for testing
 func (m *Manager) AddStorageFactory(factory StorageControllerFactory) {
 	m.factories = append(m.factories, factory)
 }
 
+// OnRetry registers a listener which is called with the destination of the storage whenever a failed upload is retried
+func (m *Manager) OnRetry(listener func(destination string)) {
+	m.onRetry = listener
+}
+
 // ScheduleSnapshot schedules the next snapshot.
 // Scheduling of snapshot is delegated to the StorageController-instances; the earliest time calculated by all
 // factories is returned. The given time when the last snapshot was taken is passed on to the factories as fallback
@@ -83,6 +118,7 @@ func (m *Manager) ScheduleSnapshot(ctx context.Context, lastSnapshotTime time.Ti
 			logging.Warn("Could not create controller", "destination", factory.Destination(), "error", err)
 		} else {
 			candidate, err := controller.ScheduleSnapshot(ctx, lastSnapshotTime, defaults)
+			closeController(factory, controller)
 			if err != nil {
 				logging.Warn("Could not schedule snapshot", "destination", factory.Destination(), "error", err)
 			} else if nextSnapshot.IsZero() || candidate.Before(nextSnapshot) {
@@ -94,53 +130,192 @@ func (m *Manager) ScheduleSnapshot(ctx context.Context, lastSnapshotTime time.Ti
 	return nextSnapshot
 }
 
-// UploadSnapshot uploads the given snapshot to all storages controlled by the StorageController-instances
-// and returns the time the next snapshot should be taken.
-// Whether the snapshot is actually uploaded to a storage is controlled by the StorageController based
-// on the upload-frequency in its StoragesConfig
-func (m *Manager) UploadSnapshot(ctx context.Context, snapshot io.ReadSeeker, snapshotSize int64, timestamp time.Time, defaults StorageConfigDefaults) time.Time {
+// ListSnapshots lists the snapshots of all storages controlled by the StorageController-instances.
+// The snapshots are grouped by storage and sorted from newest to oldest.
+// Failures of single storages do not prevent the listing of the others; they are returned as combined error
+func (m *Manager) ListSnapshots(ctx context.Context, defaults StorageConfigDefaults) ([]StoredSnapshot, error) {
 	var (
-		nextSnapshot time.Time
-		errs         error
+		snapshots []StoredSnapshot
+		errs      error
 	)
 
 	for _, factory := range m.factories {
-		if _, err := snapshot.Seek(0, io.SeekStart); err != nil {
-			logging.Error("Could not reset snapshot before uploading", "error", err)
-			return timestamp.Add(defaults.Frequency)
-		}
-
 		controller, err := factory.CreateController(ctx)
 		if err != nil {
 			logging.Warn("Could not create storage-controller", "destination", factory.Destination(), "error", err)
 			errs = multierr.Append(errs, err)
-		} else {
-			uploaded, candidate, err := controller.UploadSnapshot(ctx, snapshot, snapshotSize, timestamp, defaults)
-			if nextSnapshot.IsZero() || candidate.Before(nextSnapshot) {
-				nextSnapshot = candidate
-			}
+			continue
+		}
 
-			if err != nil {
-				logging.Warn("Could not upload snapshot", "destination", factory.Destination(), "error", err, "nextSnapshot", candidate)
-				errs = multierr.Append(errs, err)
-			} else if !uploaded {
-				logging.Debug("Skipped upload of snapshot", "destination", factory.Destination(), "nextSnapshot", candidate)
-			} else {
-				logging.Debug("Successfully uploaded snapshot", "destination", factory.Destination(), "nextSnapshot", candidate)
-
-				deleted, err := controller.DeleteObsoleteSnapshots(ctx, defaults)
-				if err != nil {
-					logging.Warn("Could not delete obsolete snapshots", "destination", factory.Destination(), "error", err)
-				} else if deleted > 0 {
-					logging.Debug("Deleted obsolete snapshots", "destination", factory.Destination(), "deleted", deleted)
-				}
-			}
+		infos, err := controller.ListSnapshots(ctx, defaults)
+		closeController(factory, controller)
+		if err != nil {
+			logging.Warn("Could not list snapshots", "destination", factory.Destination(), "error", err)
+			errs = multierr.Append(errs, err)
+			continue
+		}
+
+		for _, info := range infos {
+			snapshots = append(snapshots, StoredSnapshot{info, factory.Destination()})
 		}
 	}
 
+	return snapshots, errs
+}
+
+// UploadSnapshot uploads the given snapshot to all storages controlled by the StorageController-instances
+// together with a manifest containing the given metadata and returns the time the next snapshot should be taken.
+// Whether the snapshot is actually uploaded to a storage is controlled by the StorageController based
+// on the upload-frequency or -schedule in its StoragesConfig.
+// The uploads run concurrently, each reading the snapshot independently; obsolete snapshots of a storage are deleted
+// as soon as the upload to it succeeded.
+// Failures of single storages do not prevent the upload to the others; they are returned as combined error.
+// Failed uploads are retried according to the RetryConfig of the storage
+func (m *Manager) UploadSnapshot(ctx context.Context, snapshot io.ReaderAt, snapshotSize int64, timestamp time.Time, metadata SnapshotMetadata, defaults StorageConfigDefaults) (time.Time, error) {
+	results := make([]uploadResult, len(m.factories))
+	slots := make(chan struct{}, m.concurrencyLimit())
+
+	var wg sync.WaitGroup
+	for i, factory := range m.factories {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			results[i] = m.uploadToStorage(ctx, factory, snapshot, snapshotSize, timestamp, metadata, defaults)
+		}()
+	}
+	wg.Wait()
+
+	return aggregateResults(results)
+}
+
+// concurrencyLimit returns the number of uploads allowed to run at the same time
+func (m *Manager) concurrencyLimit() int {
+	if m.concurrency > 0 && m.concurrency < len(m.factories) {
+		return m.concurrency
+	}
+	return max(1, len(m.factories))
+}
+
+// uploadResult is the outcome of the upload to a single storage
+type uploadResult struct {
+	nextSnapshot time.Time
+	err          error
+}
+
+// aggregateResults returns the earliest time the next snapshot should be taken and the combined errors of all uploads
+func aggregateResults(results []uploadResult) (time.Time, error) {
+	var (
+		nextSnapshot time.Time
+		errs         error
+	)
+
+	for _, result := range results {
+		if !result.nextSnapshot.IsZero() && (nextSnapshot.IsZero() || result.nextSnapshot.Before(nextSnapshot)) {
+			nextSnapshot = result.nextSnapshot
+		}
+		errs = multierr.Append(errs, result.err)
+	}
+
 	if errs == nil {
 		logging.Info("Successfully uploaded snapshot to all scheduled destinations", "nextSnapshot", nextSnapshot)
 	}
 
-	return nextSnapshot
+	return nextSnapshot, errs
+}
+
+// uploadToStorage uploads the snapshot to the storage created by the given factory
+// and deletes obsolete snapshots from it if the upload succeeded
+func (m *Manager) uploadToStorage(ctx context.Context, factory StorageControllerFactory, snapshot io.ReaderAt, snapshotSize int64, timestamp time.Time, metadata SnapshotMetadata, defaults StorageConfigDefaults) uploadResult {
+	controller, uploaded, nextSnapshot, err := m.uploadSnapshot(ctx, factory, snapshot, snapshotSize, timestamp, metadata, defaults)
+	if controller == nil {
+		logging.Warn("Could not create storage-controller", "destination", factory.Destination(), "error", err)
+		return uploadResult{err: err}
+	}
+	defer closeController(factory, controller)
+
+	return completeUpload(ctx, factory, controller, uploaded, nextSnapshot, err, defaults)
+}
+
+// closeController closes the given controller; failures are only logged as they do not affect the operation
+func closeController(factory StorageControllerFactory, controller StorageController) {
+	if err := controller.Close(); err != nil {
+		logging.Warn("Could not close storage-controller", "destination", factory.Destination(), "error", err)
+	}
+}
+
+// completeUpload logs the outcome of an upload and deletes obsolete snapshots from the storage if the upload succeeded
+func completeUpload(ctx context.Context, factory StorageControllerFactory, controller StorageController, uploaded bool, nextSnapshot time.Time, err error, defaults StorageConfigDefaults) uploadResult {
+	if err != nil {
+		logging.Warn("Could not upload snapshot", "destination", factory.Destination(), "error", err, "nextSnapshot", nextSnapshot)
+		return uploadResult{nextSnapshot, err}
+	}
+
+	if !uploaded {
+		logging.Debug("Skipped upload of snapshot", "destination", factory.Destination(), "nextSnapshot", nextSnapshot)
+		return uploadResult{nextSnapshot, nil}
+	}
+
+	logging.Debug("Successfully uploaded snapshot", "destination", factory.Destination(), "nextSnapshot", nextSnapshot)
+
+	deleted, err := controller.DeleteObsoleteSnapshots(ctx, defaults)
+	if err != nil {
+		logging.Warn("Could not delete obsolete snapshots", "destination", factory.Destination(), "error", err)
+	} else if deleted > 0 {
+		logging.Debug("Deleted obsolete snapshots", "destination", factory.Destination(), "deleted", deleted)
+	}
+
+	return uploadResult{nextSnapshot, nil}
+}
+
+// uploadSnapshot creates a controller using the given factory and uploads the snapshot with it.
+// Failures are retried according to the RetryConfig of the factory; each attempt reads the snapshot from its start.
+// The returned controller is nil if it could not be created
+func (m *Manager) uploadSnapshot(ctx context.Context, factory StorageControllerFactory, snapshot io.ReaderAt, snapshotSize int64, timestamp time.Time, metadata SnapshotMetadata, defaults StorageConfigDefaults) (StorageController, bool, time.Time, error) {
+	retry := defaults.Retry
+	if configurer, ok := factory.(retryConfigurer); ok {
+		retry = configurer.retryOrDefault(defaults)
+	}
+
+	var (
+		controller StorageController
+		uploaded   bool
+		candidate  time.Time
+		err        error
+	)
+
+	for attempt := 1; attempt <= retry.attempts(); attempt++ {
+		if attempt > 1 {
+			logging.Info("Retrying upload of snapshot", "destination", factory.Destination(), "attempt", attempt, "error", err)
+			if m.onRetry != nil {
+				m.onRetry(factory.Destination())
+			}
+
+			if waitErr := retry.wait(ctx, attempt-1); waitErr != nil {
+				return controller, false, candidate, multierr.Append(err, waitErr)
+			}
+
+			// each attempt uses a new controller, e.g. to reconnect to the storage
+			if controller != nil {
+				closeController(factory, controller)
+				controller = nil
+			}
+		}
+
+		controller, err = factory.CreateController(ctx)
+		if err != nil {
+			continue
+		}
+
+		reader := io.NewSectionReader(snapshot, 0, snapshotSize)
+		uploaded, candidate, err = controller.UploadSnapshot(ctx, reader, snapshotSize, timestamp, metadata, defaults)
+		if err == nil {
+			break
+		}
+	}
+
+	return controller, uploaded, candidate, err
 }
@@ -3,18 +3,87 @@ package storage
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"io"
+	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
 
+func TestCreateManagerAddsFactoryForEachConfiguredStorage(t *testing.T) {
+	config := StoragesConfig{
+		AWS:         []AWSStorageConfig{{Bucket: "bucket"}},
+		Local:       []LocalStorageConfig{{Path: "/path1"}, {Path: "/path2"}},
+		Concurrency: 2,
+	}
+
+	manager := CreateManager(config)
+
+	assert.Equal(t, []StorageControllerFactory{config.AWS[0], config.Local[0], config.Local[1]}, manager.factories)
+	assert.Equal(t, 2, manager.concurrency)
+}
+
+func TestManagerRemovesStaleDataOnlyWhenRequested(t *testing.T) {
+	dir := t.TempDir()
+	stale := fmt.Sprintf("%s/.stale.snap%s", dir, tempFileSuffix)
+	assert.NoError(t, os.WriteFile(stale, []byte("test"), 0600))
+	old := time.Now().Add(-2 * staleTempFileAge)
+	assert.NoError(t, os.Chtimes(stale, old, old))
+
+	manager := CreateManager(StoragesConfig{Local: []LocalStorageConfig{{Path: dir}}})
+	_, err := manager.ListSnapshots(context.Background(), StorageConfigDefaults{})
+	assert.NoError(t, err, "ListSnapshots() failed unexpectedly")
+	_, err = os.Stat(stale)
+	assert.NoError(t, err, "stale temporary file should not be removed by other operations")
+
+	manager.RemoveStaleData()
+	_, err = os.Stat(stale)
+	assert.ErrorIs(t, err, os.ErrNotExist, "stale temporary file should have been removed")
+}
+
+func TestFactoriesNumbersMultipleStoragesOfSameType(t *testing.T) {
+	config := StoragesConfig{
+		GCP:   []GCPStorageConfig{{Bucket: "bucket"}},
+		Local: []LocalStorageConfig{{Path: "/path1"}, {Path: "/path2"}},
+	}
+
+	assert.Equal(t, map[string]StorageControllerFactory{
+		"gcp":     config.GCP[0],
+		"local-1": config.Local[0],
+		"local-2": config.Local[1],
+	}, config.Factories())
+	assert.True(t, config.HasStorages())
+	assert.False(t, StoragesConfig{}.HasStorages())
+}
+
+func TestDestinationDistinguishesStoragesOfSameLocation(t *testing.T) {
+	config := StoragesConfig{
+		GCP: []GCPStorageConfig{
+			{Bucket: "bucket"},
+			{Bucket: "bucket", StorageControllerConfig: StorageControllerConfig{NamePrefix: "daily-"}},
+			{Bucket: "bucket", StorageControllerConfig: StorageControllerConfig{Layout: "2006/01"}},
+		},
+		S3: []S3StorageConfig{
+			{Bucket: "bucket", Endpoint: "s3.example.com"},
+			{Bucket: "bucket", Endpoint: "s3.example.com", StorageControllerConfig: StorageControllerConfig{NamePrefix: "daily-", Layout: "2006/01"}},
+		},
+	}
+
+	assert.Equal(t, "gcp bucket bucket", config.GCP[0].Destination())
+	assert.Equal(t, "gcp bucket bucket with name-prefix daily-", config.GCP[1].Destination())
+	assert.Equal(t, "gcp bucket bucket in layout 2006/01", config.GCP[2].Destination())
+	assert.Equal(t, "s3 bucket bucket at s3.example.com", config.S3[0].Destination())
+	assert.Equal(t, "s3 bucket bucket at s3.example.com with name-prefix daily- in layout 2006/01", config.S3[1].Destination())
+}
+
 func TestManagerSchedulesEarliestNextSnapshot(t *testing.T) {
 	controller1 := &storageControllerStub{nextSnapshot: time.Now().Add(time.Millisecond * 2)}
 	controller2 := &storageControllerStub{nextSnapshot: time.Now().Add(time.Millisecond)}
 	manager := Manager{
-		[]StorageControllerFactory{
+		factories: []StorageControllerFactory{
 			storageControllerFactoryStub{controller: controller1},
 			storageControllerFactoryStub{controller: controller2},
 		},
@@ -27,7 +96,7 @@ func TestScheduleSnapshotIgnoresFactoryAndControllerFailure(t *testing.T) {
 	controller1 := &storageControllerStub{scheduleFails: true}
 	controller2 := &storageControllerStub{nextSnapshot: time.Now().Add(time.Millisecond)}
 	manager := Manager{
-		[]StorageControllerFactory{
+		factories: []StorageControllerFactory{
 			storageControllerFactoryStub{createFails: true},
 			storageControllerFactoryStub{controller: controller1},
 			storageControllerFactoryStub{controller: controller2},
@@ -44,14 +113,15 @@ func TestManagerUploadsToAllControllers(t *testing.T) {
 	controller1 := &storageControllerStub{nextSnapshot: time.Now().Add(time.Millisecond * 2)}
 	controller2 := &storageControllerStub{nextSnapshot: time.Now().Add(time.Millisecond)}
 	manager := Manager{
-		[]StorageControllerFactory{
+		factories: []StorageControllerFactory{
 			storageControllerFactoryStub{controller: controller1},
 			storageControllerFactoryStub{controller: controller2},
 		},
 	}
 
 	data := "test"
-	nextSnapshot := manager.UploadSnapshot(context.Background(), strings.NewReader(data), 0, controller1.nextSnapshot, StorageConfigDefaults{})
+	nextSnapshot, err := manager.UploadSnapshot(context.Background(), strings.NewReader(data), int64(len(data)), controller1.nextSnapshot, SnapshotMetadata{}, StorageConfigDefaults{})
+	assert.NoError(t, err, "UploadSnapshot failed unexpectedly")
 
 	assert.Equal(t, data, controller1.uploadData)
 	assert.Equal(t, controller1.nextSnapshot, controller1.snapshotTimestamp)
@@ -64,14 +134,14 @@ func TestManagerDeletesObsoleteSnapshotsWithAllControllers(t *testing.T) {
 	controller1 := &storageControllerStub{}
 	controller2 := &storageControllerStub{}
 	manager := Manager{
-		[]StorageControllerFactory{
+		factories: []StorageControllerFactory{
 			storageControllerFactoryStub{controller: controller1},
 			storageControllerFactoryStub{controller: controller2},
 		},
 	}
 
 	defaults := StorageConfigDefaults{Retain: 2}
-	_ = manager.UploadSnapshot(context.Background(), strings.NewReader("test"), 0, controller1.nextSnapshot, defaults)
+	_, _ = manager.UploadSnapshot(context.Background(), strings.NewReader("test"), 4, controller1.nextSnapshot, SnapshotMetadata{}, defaults)
 
 	assert.Equal(t, defaults, controller1.deleteDefaults)
 	assert.Equal(t, defaults, controller2.deleteDefaults)
@@ -82,7 +152,7 @@ func TestManagerIgnoresFactoryAndControllerFailure(t *testing.T) {
 	controller2 := &storageControllerStub{deleteFails: true, nextSnapshot: time.Now().Add(time.Millisecond * 2)}
 	controller3 := &storageControllerStub{nextSnapshot: time.Now().Add(time.Millisecond * 3)}
 	manager := Manager{
-		[]StorageControllerFactory{
+		factories: []StorageControllerFactory{
 			storageControllerFactoryStub{createFails: true},
 			storageControllerFactoryStub{controller: controller1},
 			storageControllerFactoryStub{controller: controller2},
@@ -92,7 +162,8 @@ func TestManagerIgnoresFactoryAndControllerFailure(t *testing.T) {
 
 	data := "test"
 	defaults := StorageConfigDefaults{}
-	nextSnapshot := manager.UploadSnapshot(context.Background(), strings.NewReader(data), 0, controller3.nextSnapshot, defaults)
+	nextSnapshot, err := manager.UploadSnapshot(context.Background(), strings.NewReader(data), int64(len(data)), controller3.nextSnapshot, SnapshotMetadata{}, defaults)
+	assert.Error(t, err, "UploadSnapshot should report failures")
 
 	assert.Equal(t, data, controller3.uploadData)
 	assert.Equal(t, controller3.nextSnapshot, controller3.snapshotTimestamp)
@@ -104,47 +175,241 @@ func TestManagerIgnoresFactoryAndControllerFailure(t *testing.T) {
 	assert.Equal(t, defaults, controller3.deleteDefaults)
 }
 
+func TestManagerRetriesFailedUploads(t *testing.T) {
+	controller := &storageControllerStub{uploadFailures: 2}
+	manager := Manager{
+		factories: []StorageControllerFactory{
+			storageControllerFactoryStub{controller: controller, destination: "test"},
+		},
+	}
+
+	var retries []string
+	manager.OnRetry(func(destination string) {
+		retries = append(retries, destination)
+	})
+
+	data := "test"
+	defaults := StorageConfigDefaults{Retry: RetryConfig{MaxAttempts: 3, InitialBackoff: time.Millisecond}}
+	_, err := manager.UploadSnapshot(context.Background(), strings.NewReader(data), int64(len(data)), time.Now(), SnapshotMetadata{}, defaults)
+	assert.NoError(t, err, "UploadSnapshot failed unexpectedly")
+
+	assert.Equal(t, 3, controller.uploadAttempts)
+	assert.Equal(t, []string{"test", "test"}, retries)
+	assert.Equal(t, data, controller.uploadData, "snapshot should be reset before retrying")
+	assert.Equal(t, 3, controller.closed, "controller of each attempt should be closed")
+}
+
+func TestManagerClosesControllers(t *testing.T) {
+	controller := &storageControllerStub{}
+	manager := Manager{
+		factories: []StorageControllerFactory{
+			storageControllerFactoryStub{controller: controller},
+		},
+	}
+
+	manager.ScheduleSnapshot(context.Background(), time.Now(), StorageConfigDefaults{})
+	assert.Equal(t, 1, controller.closed)
+
+	_, err := manager.ListSnapshots(context.Background(), StorageConfigDefaults{})
+	assert.NoError(t, err, "ListSnapshots failed unexpectedly")
+	assert.Equal(t, 2, controller.closed)
+
+	data := "test"
+	_, err = manager.UploadSnapshot(context.Background(), strings.NewReader(data), int64(len(data)), time.Now(), SnapshotMetadata{}, StorageConfigDefaults{})
+	assert.NoError(t, err, "UploadSnapshot failed unexpectedly")
+	assert.Equal(t, 3, controller.closed)
+}
+
+func TestManagerRetriesFailedControllerCreation(t *testing.T) {
+	controller := &storageControllerStub{}
+	factory := &failingStorageControllerFactoryStub{failures: 1, controller: controller}
+	manager := Manager{
+		factories: []StorageControllerFactory{factory},
+	}
+
+	defaults := StorageConfigDefaults{Retry: RetryConfig{MaxAttempts: 2, InitialBackoff: time.Millisecond}}
+	_, err := manager.UploadSnapshot(context.Background(), strings.NewReader("test"), 4, time.Now(), SnapshotMetadata{}, defaults)
+	assert.NoError(t, err, "UploadSnapshot failed unexpectedly")
+
+	assert.Equal(t, 2, factory.attempts)
+	assert.Equal(t, 1, controller.uploadAttempts)
+}
+
+func TestManagerGivesUpAfterMaxAttempts(t *testing.T) {
+	controller := &storageControllerStub{uploadFails: true}
+	manager := Manager{
+		factories: []StorageControllerFactory{
+			storageControllerFactoryStub{controller: controller},
+		},
+	}
+
+	defaults := StorageConfigDefaults{Retry: RetryConfig{MaxAttempts: 2, InitialBackoff: time.Millisecond}}
+	_, err := manager.UploadSnapshot(context.Background(), strings.NewReader("test"), 4, time.Now(), SnapshotMetadata{}, defaults)
+	assert.Error(t, err, "UploadSnapshot should fail after max attempts")
+
+	assert.Equal(t, 2, controller.uploadAttempts)
+}
+
+func TestManagerUsesRetryConfigOfStorage(t *testing.T) {
+	controller := &storageControllerStub{uploadFails: true}
+	manager := Manager{
+		factories: []StorageControllerFactory{
+			retryingStorageControllerFactoryStub{
+				storageControllerFactoryStub: storageControllerFactoryStub{controller: controller},
+				StorageControllerConfig:      StorageControllerConfig{Retry: &RetryConfig{MaxAttempts: 3}},
+			},
+		},
+	}
+
+	defaults := StorageConfigDefaults{Retry: RetryConfig{MaxAttempts: 1}}
+	_, err := manager.UploadSnapshot(context.Background(), strings.NewReader("test"), 4, time.Now(), SnapshotMetadata{}, defaults)
+	assert.Error(t, err, "UploadSnapshot should fail after max attempts")
+
+	assert.Equal(t, 3, controller.uploadAttempts)
+}
+
+func TestManagerStopsRetryingWhenContextIsDone(t *testing.T) {
+	controller := &storageControllerStub{uploadFails: true}
+	manager := Manager{
+		factories: []StorageControllerFactory{
+			storageControllerFactoryStub{controller: controller},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	manager.OnRetry(func(string) { cancel() })
+
+	defaults := StorageConfigDefaults{Retry: RetryConfig{MaxAttempts: 3, InitialBackoff: time.Hour}}
+	_, err := manager.UploadSnapshot(ctx, strings.NewReader("test"), 4, time.Now(), SnapshotMetadata{}, defaults)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	assert.Equal(t, 1, controller.uploadAttempts)
+}
+
 func TestManagerIgnoresSkippedControllers(t *testing.T) {
 	controller1 := &storageControllerStub{nextSnapshot: time.Now().Add(time.Millisecond * 2)}
 	controller2 := &storageControllerStub{nextSnapshot: time.Now().Add(time.Millisecond)}
 	manager := Manager{
-		[]StorageControllerFactory{
+		factories: []StorageControllerFactory{
 			storageControllerFactoryStub{controller: controller1},
 			storageControllerFactoryStub{controller: controller2},
 		},
 	}
 
 	data := "test"
-	nextSnapshot := manager.UploadSnapshot(context.Background(), strings.NewReader(data), 0, controller2.nextSnapshot, StorageConfigDefaults{})
+	nextSnapshot, err := manager.UploadSnapshot(context.Background(), strings.NewReader(data), int64(len(data)), controller2.nextSnapshot, SnapshotMetadata{}, StorageConfigDefaults{})
+	assert.NoError(t, err, "UploadSnapshot failed unexpectedly")
 
 	assert.Equal(t, data, controller2.uploadData)
 	assert.Equal(t, controller2.nextSnapshot, controller2.snapshotTimestamp)
 	assert.Equal(t, controller2.nextSnapshot, nextSnapshot)
 }
 
-func TestManagerFailsIfSnapshotCannotBeReset(t *testing.T) {
-	controller := &storageControllerStub{}
+func TestManagerUploadsToAllControllersConcurrently(t *testing.T) {
+	tracker := &concurrencyTracker{}
+	manager := Manager{}
+	for i := 0; i < 3; i++ {
+		manager.AddStorageFactory(concurrentStorageControllerFactoryStub{
+			concurrentStorageControllerStub{storageControllerStub: &storageControllerStub{}, tracker: tracker},
+		})
+	}
+
+	data := "test"
+	_, err := manager.UploadSnapshot(context.Background(), strings.NewReader(data), int64(len(data)), time.Now(), SnapshotMetadata{}, StorageConfigDefaults{})
+	assert.NoError(t, err, "UploadSnapshot failed unexpectedly")
+
+	assert.Equal(t, 3, tracker.maxRunning)
+	for _, factory := range manager.factories {
+		assert.Equal(t, data, factory.(concurrentStorageControllerFactoryStub).controller.uploadData)
+	}
+}
+
+func TestManagerLimitsConcurrentUploads(t *testing.T) {
+	tracker := &concurrencyTracker{}
+	manager := Manager{concurrency: 2}
+	for i := 0; i < 4; i++ {
+		manager.AddStorageFactory(concurrentStorageControllerFactoryStub{
+			concurrentStorageControllerStub{storageControllerStub: &storageControllerStub{}, tracker: tracker},
+		})
+	}
+
+	data := "test"
+	_, err := manager.UploadSnapshot(context.Background(), strings.NewReader(data), int64(len(data)), time.Now(), SnapshotMetadata{}, StorageConfigDefaults{})
+	assert.NoError(t, err, "UploadSnapshot failed unexpectedly")
+
+	assert.LessOrEqual(t, tracker.maxRunning, 2)
+	for _, factory := range manager.factories {
+		assert.Equal(t, data, factory.(concurrentStorageControllerFactoryStub).controller.uploadData)
+	}
+}
+
+func TestManagerDeletesObsoleteSnapshotsWithoutWaitingForOtherUploads(t *testing.T) {
+	deleted := make(chan struct{})
+	fast := concurrentStorageControllerStub{storageControllerStub: &storageControllerStub{}, deleted: deleted}
+	slow := concurrentStorageControllerStub{storageControllerStub: &storageControllerStub{}, awaitUpload: deleted}
 	manager := Manager{
-		[]StorageControllerFactory{
-			storageControllerFactoryStub{controller: controller},
+		factories: []StorageControllerFactory{
+			concurrentStorageControllerFactoryStub{slow},
+			concurrentStorageControllerFactoryStub{fast},
 		},
 	}
 
-	defaults := StorageConfigDefaults{Frequency: time.Second}
-	timestamp := time.Now()
-	nextSnapshot := manager.UploadSnapshot(context.Background(), ReadSeekerStub{}, 0, timestamp, defaults)
+	defaults := StorageConfigDefaults{Retain: 2}
+	_, err := manager.UploadSnapshot(context.Background(), strings.NewReader("test"), 4, time.Now(), SnapshotMetadata{}, defaults)
+	assert.NoError(t, err, "slow upload should have been released by the deletion of the fast storage")
 
-	assert.Equal(t, timestamp.Add(defaults.Frequency), nextSnapshot)
-	assert.Zero(t, controller.uploadData)
+	assert.Equal(t, defaults, fast.deleteDefaults)
+	assert.Equal(t, defaults, slow.deleteDefaults)
+}
+
+func TestManagerListsSnapshotsOfAllControllers(t *testing.T) {
+	now := time.Now()
+	controller1 := &storageControllerStub{snapshots: []SnapshotInfo{{Name: "snapshot-1", Size: 1, LastModified: now}}}
+	controller2 := &storageControllerStub{snapshots: []SnapshotInfo{{Name: "snapshot-2", Size: 2, LastModified: now}}}
+	manager := Manager{
+		factories: []StorageControllerFactory{
+			storageControllerFactoryStub{controller: controller1, destination: "destination-1"},
+			storageControllerFactoryStub{controller: controller2, destination: "destination-2"},
+		},
+	}
+
+	defaults := StorageConfigDefaults{NamePrefix: "snapshot-"}
+	snapshots, err := manager.ListSnapshots(context.Background(), defaults)
+
+	assert.NoError(t, err, "ListSnapshots failed unexpectedly")
+	assert.Equal(t, []StoredSnapshot{
+		{controller1.snapshots[0], "destination-1"},
+		{controller2.snapshots[0], "destination-2"},
+	}, snapshots)
+	assert.Equal(t, defaults, controller1.listDefaults)
+	assert.Equal(t, defaults, controller2.listDefaults)
+}
+
+func TestManagerListsSnapshotsDespiteFactoryAndControllerFailure(t *testing.T) {
+	controller1 := &storageControllerStub{listFails: true}
+	controller2 := &storageControllerStub{snapshots: []SnapshotInfo{{Name: "snapshot"}}}
+	manager := Manager{
+		factories: []StorageControllerFactory{
+			storageControllerFactoryStub{createFails: true},
+			storageControllerFactoryStub{controller: controller1},
+			storageControllerFactoryStub{controller: controller2},
+		},
+	}
+
+	snapshots, err := manager.ListSnapshots(context.Background(), StorageConfigDefaults{})
+
+	assert.Error(t, err)
+	assert.Equal(t, []StoredSnapshot{{controller2.snapshots[0], ""}}, snapshots)
 }
 
 type storageControllerFactoryStub struct {
 	createFails bool
 	controller  *storageControllerStub
+	destination string
 }
 
 func (stub storageControllerFactoryStub) Destination() string {
-	return ""
+	return stub.destination
 }
 
 func (stub storageControllerFactoryStub) CreateController(context.Context) (StorageController, error) {
@@ -154,15 +419,44 @@ func (stub storageControllerFactoryStub) CreateController(context.Context) (Stor
 	return stub.controller, nil
 }
 
+type failingStorageControllerFactoryStub struct {
+	failures   int
+	attempts   int
+	controller *storageControllerStub
+}
+
+func (stub *failingStorageControllerFactoryStub) Destination() string {
+	return ""
+}
+
+func (stub *failingStorageControllerFactoryStub) CreateController(context.Context) (StorageController, error) {
+	stub.attempts++
+	if stub.attempts <= stub.failures {
+		return nil, errors.New("create failed")
+	}
+	return stub.controller, nil
+}
+
+type retryingStorageControllerFactoryStub struct {
+	storageControllerFactoryStub
+	StorageControllerConfig
+}
+
 type storageControllerStub struct {
 	uploadDefaults    StorageConfigDefaults
 	scheduleFails     bool
 	uploadData        string
 	uploadFails       bool
+	uploadFailures    int
+	uploadAttempts    int
 	deleteFails       bool
 	deleteDefaults    StorageConfigDefaults
 	snapshotTimestamp time.Time
 	nextSnapshot      time.Time
+	snapshots         []SnapshotInfo
+	listFails         bool
+	listDefaults      StorageConfigDefaults
+	closed            int
 }
 
 func (stub *storageControllerStub) ScheduleSnapshot(context.Context, time.Time, StorageConfigDefaults) (time.Time, error) {
@@ -172,10 +466,12 @@ func (stub *storageControllerStub) ScheduleSnapshot(context.Context, time.Time,
 	return stub.nextSnapshot, nil
 }
 
-func (stub *storageControllerStub) UploadSnapshot(_ context.Context, snapshot io.Reader, _ int64, timestamp time.Time, defaults StorageConfigDefaults) (bool, time.Time, error) {
+func (stub *storageControllerStub) UploadSnapshot(_ context.Context, snapshot io.Reader, _ int64, timestamp time.Time, _ SnapshotMetadata, defaults StorageConfigDefaults) (bool, time.Time, error) {
 	stub.snapshotTimestamp = timestamp
 	stub.uploadDefaults = defaults
-	if stub.uploadFails {
+	stub.uploadAttempts++
+	if stub.uploadFails || stub.uploadAttempts <= stub.uploadFailures {
+		_, _ = io.ReadAll(snapshot)
 		return false, stub.nextSnapshot, errors.New("upload failed")
 	}
 
@@ -200,12 +496,84 @@ func (stub *storageControllerStub) DeleteObsoleteSnapshots(_ context.Context, de
 	return 1, nil
 }
 
-type ReadSeekerStub struct{}
+func (stub *storageControllerStub) ListSnapshots(_ context.Context, defaults StorageConfigDefaults) ([]SnapshotInfo, error) {
+	stub.listDefaults = defaults
+	if stub.listFails {
+		return nil, errors.New("listing failed")
+	}
+	return stub.snapshots, nil
+}
+
+func (stub *storageControllerStub) DownloadSnapshot(context.Context, string, StorageConfigDefaults) (io.ReadCloser, error) {
+	return nil, errors.New("download not supported")
+}
+
+func (stub *storageControllerStub) Close() error {
+	stub.closed++
+	return nil
+}
+
+// concurrencyTracker records the maximum number of uploads running at the same time
+type concurrencyTracker struct {
+	lock       sync.Mutex
+	running    int
+	maxRunning int
+}
+
+func (t *concurrencyTracker) track(duration time.Duration) {
+	t.lock.Lock()
+	t.running++
+	t.maxRunning = max(t.maxRunning, t.running)
+	t.lock.Unlock()
+
+	time.Sleep(duration)
 
-func (stub ReadSeekerStub) Seek(int64, int) (int64, error) {
-	return 0, errors.New("seek failed")
+	t.lock.Lock()
+	t.running--
+	t.lock.Unlock()
 }
 
-func (stub ReadSeekerStub) Read([]byte) (n int, err error) {
-	return 0, nil
+type concurrentStorageControllerFactoryStub struct {
+	controller concurrentStorageControllerStub
+}
+
+func (stub concurrentStorageControllerFactoryStub) Destination() string {
+	return ""
+}
+
+func (stub concurrentStorageControllerFactoryStub) CreateController(context.Context) (StorageController, error) {
+	return stub.controller, nil
+}
+
+// concurrentStorageControllerStub tracks concurrent uploads, waits for awaitUpload before uploading
+// and closes deleted after deleting obsolete snapshots if the respective fields are set
+type concurrentStorageControllerStub struct {
+	*storageControllerStub
+	tracker     *concurrencyTracker
+	awaitUpload <-chan struct{}
+	deleted     chan struct{}
+}
+
+func (stub concurrentStorageControllerStub) UploadSnapshot(ctx context.Context, snapshot io.Reader, snapshotSize int64, timestamp time.Time, metadata SnapshotMetadata, defaults StorageConfigDefaults) (bool, time.Time, error) {
+	if stub.tracker != nil {
+		stub.tracker.track(time.Millisecond * 50)
+	}
+
+	if stub.awaitUpload != nil {
+		select {
+		case <-stub.awaitUpload:
+		case <-time.After(time.Second * 5):
+			return false, stub.nextSnapshot, errors.New("upload not released")
+		}
+	}
+
+	return stub.storageControllerStub.UploadSnapshot(ctx, snapshot, snapshotSize, timestamp, metadata, defaults)
+}
+
+func (stub concurrentStorageControllerStub) DeleteObsoleteSnapshots(ctx context.Context, defaults StorageConfigDefaults) (int, error) {
+	deleted, err := stub.storageControllerStub.DeleteObsoleteSnapshots(ctx, defaults)
+	if stub.deleted != nil {
+		close(stub.deleted)
+	}
+	return deleted, err
 }
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"strings"
+	"time"
+)
+
+// manifestSuffix is appended to the name of a snapshot to create the name of its manifest
+const manifestSuffix = ".manifest.json"
+
+// SnapshotMetadata describes the origin of a snapshot
+type SnapshotMetadata struct {
+	Node         string `json:"node"`
+	RaftIndex    uint64 `json:"raftIndex"`
+	RaftTerm     uint64 `json:"raftTerm"`
+	AgentVersion string `json:"agentVersion"`
+	VaultVersion string `json:"vaultVersion"`
+}
+
+// SnapshotManifest is uploaded alongside each snapshot and describes the stored snapshot and its origin
+type SnapshotManifest struct {
+	SnapshotMetadata
+	Snapshot  string    `json:"snapshot"`
+	Timestamp time.Time `json:"timestamp"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+}
+
+// manifestName returns the name of the manifest of the snapshot with the given name
+func manifestName(snapshotName string) string {
+	return snapshotName + manifestSuffix
+}
+
+// isManifest returns true if the given name is the name of a manifest
+func isManifest(name string) bool {
+	return strings.HasSuffix(name, manifestSuffix)
+}
+
+// uploadManifest uploads the given manifest as json next to the snapshot described by it
+func uploadManifest[S any](ctx context.Context, storage storage[S], manifest SnapshotManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return storage.uploadSnapshot(ctx, manifestName(manifest.Snapshot), bytes.NewReader(data), int64(len(data)))
+}
+
+// checksumReader calculates the size and SHA-256-checksum of the data read from the wrapped reader
+type checksumReader struct {
+	reader io.Reader
+	hash   hash.Hash
+	size   int64
+}
+
+func newChecksumReader(reader io.Reader) *checksumReader {
+	return &checksumReader{reader: reader, hash: sha256.New()}
+}
+
+func (r *checksumReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.hash.Write(p[:n])
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *checksumReader) checksum() string {
+	return hex.EncodeToString(r.hash.Sum(nil))
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+// RetentionConfig configures how many snapshots are retained per time-period.
+// For each period the newest snapshot is retained, e.g. Daily: 7 retains the newest snapshot of each of the
+// last seven days for which snapshots exist.
+type RetentionConfig struct {
+	Hourly  int `validate:"gte=0"`
+	Daily   int `validate:"gte=0"`
+	Weekly  int `validate:"gte=0"`
+	Monthly int `validate:"gte=0"`
+	Yearly  int `validate:"gte=0"`
+}
+
+type retentionPeriod struct {
+	retain int
+	key    func(time.Time) string
+}
+
+func (c RetentionConfig) isZero() bool {
+	return c == RetentionConfig{}
+}
+
+func (c RetentionConfig) periods() []retentionPeriod {
+	return []retentionPeriod{
+		{c.Hourly, func(t time.Time) string { return t.Format("2006-01-02T15") }},
+		{c.Daily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{c.Weekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-%d", year, week)
+		}},
+		{c.Monthly, func(t time.Time) string { return t.Format("2006-01") }},
+		{c.Yearly, func(t time.Time) string { return t.Format("2006") }},
+	}
+}
+
+// retainedSnapshots determines which of the given snapshots are retained according to the given number
+// of snapshots to retain and the RetentionConfig. The snapshots must be sorted from newest to oldest.
+// A snapshot is retained if it is one of the newest retain snapshots or if it is retained for any
+// of the periods configured by the RetentionConfig.
+// If neither retain nor the RetentionConfig are configured, all snapshots are retained.
+func retainedSnapshots[S any](snapshots []S, timestamp func(S) time.Time, retain int, retention RetentionConfig) []bool {
+	retained := make([]bool, len(snapshots))
+	if retain < 1 && retention.isZero() {
+		retain = len(snapshots)
+	}
+
+	for i := 0; i < len(snapshots) && i < retain; i++ {
+		retained[i] = true
+	}
+
+	for _, period := range retention.periods() {
+		if period.retain < 1 {
+			continue
+		}
+
+		kept := 0
+		lastKey := ""
+		for i, snapshot := range snapshots {
+			if kept >= period.retain {
+				break
+			}
+
+			key := period.key(timestamp(snapshot).Local())
+			if key != lastKey {
+				retained[i] = true
+				lastKey = key
+				kept++
+			}
+		}
+	}
+
+	return retained
+}
+
+// limitRetainedSnapshots removes all snapshots older than maxAge and the oldest snapshots exceeding maxTotalSize
+// from the given retained snapshots. The snapshots must be sorted from newest to oldest.
+// The newest snapshot is always retained regardless of its age or size.
+func limitRetainedSnapshots[S any](snapshots []S, retained []bool, timestamp func(S) time.Time, size func(S) int64, maxAge time.Duration, maxTotalSize int64) {
+	if maxAge > 0 {
+		oldest := time.Now().Add(-maxAge)
+		for i := 1; i < len(snapshots); i++ {
+			if timestamp(snapshots[i]).Before(oldest) {
+				retained[i] = false
+			}
+		}
+	}
+
+	if maxTotalSize > 0 {
+		var totalSize int64
+		for i := range snapshots {
+			if retained[i] {
+				totalSize += size(snapshots[i])
+			}
+		}
+
+		for i := len(snapshots) - 1; i > 0 && totalSize > maxTotalSize; i-- {
+			if retained[i] {
+				retained[i] = false
+				totalSize -= size(snapshots[i])
+			}
+		}
+	}
+}
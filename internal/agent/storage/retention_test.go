@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetainedSnapshotsRetainsNewestSnapshots(t *testing.T) {
+	now := time.Now()
+	snapshots := []time.Time{now, now.Add(-time.Minute), now.Add(-time.Hour)}
+
+	retained := retainedSnapshots(snapshots, identity, 2, RetentionConfig{})
+
+	assert.Equal(t, []bool{true, true, false}, retained)
+}
+
+func TestRetainedSnapshotsRetainsNewestSnapshotPerPeriod(t *testing.T) {
+	start := time.Date(2024, 3, 31, 22, 30, 0, 0, time.Local)
+
+	var snapshots []time.Time
+	for i := 0; i < 24*40; i++ {
+		snapshots = append(snapshots, start.Add(time.Duration(-i)*time.Hour))
+	}
+
+	retained := retainedSnapshots(snapshots, identity, 0, RetentionConfig{Hourly: 3, Daily: 2, Monthly: 2})
+
+	var retainedTimes []time.Time
+	for i, r := range retained {
+		if r {
+			retainedTimes = append(retainedTimes, snapshots[i])
+		}
+	}
+
+	assert.Equal(t, []time.Time{
+		start,
+		start.Add(-time.Hour),
+		start.Add(-2 * time.Hour),
+		time.Date(2024, 3, 30, 23, 30, 0, 0, time.Local),
+		time.Date(2024, 2, 29, 23, 30, 0, 0, time.Local),
+	}, retainedTimes)
+}
+
+func TestRetainedSnapshotsCombinesRetainAndPeriods(t *testing.T) {
+	start := time.Date(2024, 1, 10, 12, 0, 0, 0, time.Local)
+	snapshots := []time.Time{
+		start,
+		start.Add(-time.Minute),
+		start.Add(-2 * time.Minute),
+		start.Add(-24 * time.Hour),
+		start.Add(-7 * 24 * time.Hour),
+		start.Add(-365 * 24 * time.Hour),
+	}
+
+	retained := retainedSnapshots(snapshots, identity, 2, RetentionConfig{Weekly: 2, Yearly: 2})
+
+	assert.Equal(t, []bool{true, true, false, false, true, true}, retained)
+}
+
+func identity(t time.Time) time.Time {
+	return t
+}
+
+func TestLimitRetainedSnapshotsRemovesSnapshotsOlderThanMaxAge(t *testing.T) {
+	now := time.Now()
+	snapshots := []time.Time{now.Add(-2 * time.Hour), now.Add(-3 * time.Hour), now.Add(-30 * time.Minute)}
+	retained := []bool{true, true, true}
+
+	limitRetainedSnapshots(snapshots, retained, identity, func(time.Time) int64 { return 1 }, time.Hour, 0)
+
+	assert.Equal(t, []bool{true, false, true}, retained)
+}
+
+func TestLimitRetainedSnapshotsRemovesOldestSnapshotsExceedingMaxTotalSize(t *testing.T) {
+	now := time.Now()
+	snapshots := []time.Time{now, now.Add(-time.Hour), now.Add(-2 * time.Hour), now.Add(-3 * time.Hour)}
+	retained := []bool{true, true, false, true}
+
+	limitRetainedSnapshots(snapshots, retained, identity, func(time.Time) int64 { return 10 }, 0, 20)
+
+	assert.Equal(t, []bool{true, true, false, false}, retained)
+}
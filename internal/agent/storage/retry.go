@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryConfig configures how often and when failed uploads to a storage are retried
+type RetryConfig struct {
+	MaxAttempts    int           `default:"3" validate:"gte=0"`
+	InitialBackoff time.Duration `default:"5s" validate:"gte=0"`
+	MaxBackoff     time.Duration `default:"1m" validate:"gte=0"`
+	Jitter         float64       `default:"0.1" validate:"gte=0,lte=1"`
+}
+
+// retryConfigurer is implemented by factories whose StorageControllerConfig configures the retries of failed uploads
+type retryConfigurer interface {
+	retryOrDefault(defaults StorageConfigDefaults) RetryConfig
+}
+
+// attempts returns the maximum number of attempts; at least one attempt is always made
+func (c RetryConfig) attempts() int {
+	return max(1, c.MaxAttempts)
+}
+
+// backoff returns the time to wait before the given retry, starting with 1 for the first retry.
+// The backoff doubles with every retry up to MaxBackoff and is randomly varied by the fraction configured as Jitter
+func (c RetryConfig) backoff(retry int) time.Duration {
+	backoff := c.InitialBackoff
+	for i := 1; i < retry && (c.MaxBackoff <= 0 || backoff < c.MaxBackoff); i++ {
+		backoff *= 2
+	}
+
+	if c.MaxBackoff > 0 && backoff > c.MaxBackoff {
+		backoff = c.MaxBackoff
+	}
+
+	if c.Jitter > 0 {
+		backoff += time.Duration(float64(backoff) * c.Jitter * (rand.Float64()*2 - 1))
+	}
+
+	return backoff
+}
+
+// wait waits for the backoff of the given retry; it returns the error of the context if it is done before
+func (c RetryConfig) wait(ctx context.Context, retry int) error {
+	timer := time.NewTimer(c.backoff(retry))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryMakesAtLeastOneAttempt(t *testing.T) {
+	assert.Equal(t, 1, RetryConfig{}.attempts())
+	assert.Equal(t, 1, RetryConfig{MaxAttempts: 1}.attempts())
+	assert.Equal(t, 3, RetryConfig{MaxAttempts: 3}.attempts())
+}
+
+func TestRetryBackoffDoublesUpToMaxBackoff(t *testing.T) {
+	config := RetryConfig{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+
+	assert.Equal(t, time.Second, config.backoff(1))
+	assert.Equal(t, 2*time.Second, config.backoff(2))
+	assert.Equal(t, 4*time.Second, config.backoff(3))
+	assert.Equal(t, 5*time.Second, config.backoff(4))
+	assert.Equal(t, 5*time.Second, config.backoff(100))
+}
+
+func TestRetryBackoffAppliesJitter(t *testing.T) {
+	config := RetryConfig{InitialBackoff: time.Second, MaxBackoff: time.Minute, Jitter: 0.5}
+
+	for i := 0; i < 100; i++ {
+		backoff := config.backoff(2)
+		assert.GreaterOrEqual(t, backoff, time.Second)
+		assert.LessOrEqual(t, backoff, 3*time.Second)
+	}
+}
+
+func TestRetryWaitReturnsWhenContextIsDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := RetryConfig{InitialBackoff: time.Hour}.wait(ctx, 1)
+	assert.ErrorIs(t, err, context.Canceled)
+}
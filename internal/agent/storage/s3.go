@@ -34,7 +34,7 @@ type s3StorageImpl struct {
 }
 
 func (conf S3StorageConfig) Destination() string {
-	return fmt.Sprintf("s3 bucket %s at %s", conf.Bucket, conf.Endpoint)
+	return conf.describeDestination(fmt.Sprintf("s3 bucket %s at %s", conf.Bucket, conf.Endpoint))
 }
 
 func (conf S3StorageConfig) CreateController(ctx context.Context) (StorageController, error) {
@@ -119,9 +119,9 @@ func (s s3StorageImpl) deleteSnapshot(ctx context.Context, snapshot minio.Object
 
 // nolint:unused
 // implements interface storage
-func (s s3StorageImpl) listSnapshots(ctx context.Context, prefix string, ext string) ([]minio.ObjectInfo, error) {
+func (s s3StorageImpl) listSnapshots(ctx context.Context, prefix string, ext string, recursive bool) ([]minio.ObjectInfo, error) {
 	var result []minio.ObjectInfo
-	objectCh := s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix})
+	objectCh := s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: recursive})
 
 	for snapshot := range objectCh {
 		if snapshot.Err != nil {
@@ -135,8 +135,26 @@ func (s s3StorageImpl) listSnapshots(ctx context.Context, prefix string, ext str
 	return result, nil
 }
 
+// nolint:unused
+// implements interface storage
+func (s s3StorageImpl) downloadSnapshot(ctx context.Context, snapshot minio.ObjectInfo) (io.ReadCloser, error) {
+	return s.client.GetObject(ctx, s.bucket, snapshot.Key, minio.GetObjectOptions{})
+}
+
+// nolint:unused
+// implements interface storage
+func (s s3StorageImpl) getName(snapshot minio.ObjectInfo) string {
+	return snapshot.Key
+}
+
 // nolint:unused
 // implements interface storage
 func (s s3StorageImpl) getLastModifiedTime(snapshot minio.ObjectInfo) time.Time {
 	return snapshot.LastModified
 }
+
+// nolint:unused
+// implements interface storage
+func (s s3StorageImpl) getSize(snapshot minio.ObjectInfo) int64 {
+	return snapshot.Size
+}
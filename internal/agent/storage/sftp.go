@@ -0,0 +1,392 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/config/secret"
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/logging"
+	"go.uber.org/multierr"
+	"io"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+type SFTPStorageConfig struct {
+	StorageControllerConfig `mapstructure:",squash"`
+	Host                    string        `validate:"required"`
+	Port                    int           `default:"22" validate:"gt=0,lte=65535"`
+	Username                secret.Secret `default:"env://SFTP_USERNAME" validate:"required"`
+	Password                secret.Secret `default:"env://SFTP_PASSWORD"`
+	PrivateKey              secret.Secret `default:"env://SFTP_PRIVATE_KEY"`
+	PrivateKeyPassphrase    secret.Secret `default:"env://SFTP_PRIVATE_KEY_PASSPHRASE"`
+	KnownHostsFile          string        `validate:"required_unless=SkipHostKeyVerification true,omitempty,file"`
+	SkipHostKeyVerification bool
+	Path                    string `validate:"required"`
+}
+
+// sftpConnectTimeout limits the time to establish the connection to the sftp-server including the ssh-handshake
+const sftpConnectTimeout = 30 * time.Second
+
+// sftpStorageImpl uses a single connection for all operations of its controller.
+// The connection is closed when the context of an operation is done, so that stalled servers do not block the agent
+type sftpStorageImpl struct {
+	connect func(ctx context.Context) (*sftpConnection, error)
+	path    string
+	lock    sync.Mutex
+	conn    *sftpConnection
+}
+
+// sftpConnection closes the underlying ssh-connection together with the sftp-client
+type sftpConnection struct {
+	*sftp.Client
+	conn io.Closer
+}
+
+func (c *sftpConnection) Close() error {
+	return multierr.Append(c.Client.Close(), c.conn.Close())
+}
+
+func (conf SFTPStorageConfig) Destination() string {
+	return conf.describeDestination(fmt.Sprintf("sftp path %s at %s", conf.Path, net.JoinHostPort(conf.Host, strconv.Itoa(conf.Port))))
+}
+
+func (conf SFTPStorageConfig) CreateController(ctx context.Context) (StorageController, error) {
+	sshConfig, err := createSSHClientConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	address := net.JoinHostPort(conf.Host, strconv.Itoa(conf.Port))
+	connect := func(ctx context.Context) (*sftpConnection, error) {
+		return connectSFTP(ctx, address, sshConfig)
+	}
+
+	impl := &sftpStorageImpl{connect: connect, path: conf.Path}
+	conn, release, err := impl.connection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if _, err := conn.Stat(conf.Path); err != nil {
+		_ = impl.Close()
+		return nil, fmt.Errorf("invalid path %s: %s", conf.Path, err)
+	}
+
+	return newStorageController[os.FileInfo](conf.StorageControllerConfig, impl), nil
+}
+
+func createSSHClientConfig(config SFTPStorageConfig) (*ssh.ClientConfig, error) {
+	username, err := config.Username.Resolve(true)
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err := createSSHAuthMethods(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var hostKeyCallback ssh.HostKeyCallback
+	if config.SkipHostKeyVerification {
+		logging.Warn("Host-key verification of sftp-server is disabled", "host", config.Host)
+		hostKeyCallback = ssh.InsecureIgnoreHostKey()
+	} else {
+		hostKeyCallback, err = knownhosts.New(config.KnownHostsFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read known-hosts-file %s: %s", config.KnownHostsFile, err)
+		}
+	}
+
+	return &ssh.ClientConfig{
+		User:            username,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         sftpConnectTimeout,
+	}, nil
+}
+
+func createSSHAuthMethods(config SFTPStorageConfig) ([]ssh.AuthMethod, error) {
+	var auth []ssh.AuthMethod
+
+	privateKey, err := config.PrivateKey.Resolve(false)
+	if err != nil {
+		return nil, err
+	}
+
+	if privateKey != "" {
+		passphrase, err := config.PrivateKeyPassphrase.Resolve(false)
+		if err != nil {
+			return nil, err
+		}
+
+		var signer ssh.Signer
+		if passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(privateKey), []byte(passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey([]byte(privateKey))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid private key: %s", err)
+		}
+
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+
+	password, err := config.Password.Resolve(false)
+	if err != nil {
+		return nil, err
+	}
+
+	if password != "" {
+		auth = append(auth, ssh.Password(password))
+	}
+
+	if len(auth) < 1 {
+		return nil, errors.New("either password or private key is required")
+	}
+
+	return auth, nil
+}
+
+func connectSFTP(ctx context.Context, address string, config *ssh.ClientConfig) (*sftpConnection, error) {
+	dialer := net.Dialer{Timeout: config.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	// the handshakes do not watch the context, so they are aborted by a deadline or by closing the connection
+	deadline := time.Now().Add(config.Timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	_ = conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	sshConn, channels, requests, err := ssh.NewClientConn(conn, address, config)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	sshClient := ssh.NewClient(sshConn, channels, requests)
+	client, err := sftp.NewClient(sshClient)
+	if err != nil {
+		_ = sshClient.Close()
+		return nil, err
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+	return &sftpConnection{client, sshClient}, nil
+}
+
+// connection returns the connection of the storage and connects to the server if not connected yet.
+// The connection is closed if the given context is done before the returned release-function is called;
+// this aborts the running operation and the next operation connects again
+func (u *sftpStorageImpl) connection(ctx context.Context) (*sftpConnection, func(), error) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if u.conn == nil {
+		conn, err := u.connect(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		u.conn = conn
+	}
+
+	conn := u.conn
+	stop := context.AfterFunc(ctx, func() { u.disconnect(conn) })
+	return conn, func() { stop() }, nil
+}
+
+// disconnect closes the given connection and resets the connection of the storage if it is still in use
+func (u *sftpStorageImpl) disconnect(conn *sftpConnection) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if u.conn == conn {
+		u.conn = nil
+	}
+	_ = conn.Close()
+}
+
+// Close closes the connection of the storage
+func (u *sftpStorageImpl) Close() error {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if u.conn == nil {
+		return nil
+	}
+
+	err := u.conn.Close()
+	u.conn = nil
+	return err
+}
+
+// nolint:unused
+// implements interface storage
+// uploadSnapshot writes the snapshot to a hidden temporary file which is renamed to the snapshot's name
+// after all data has been written, so that an interrupted upload never leaves a truncated snapshot
+func (u *sftpStorageImpl) uploadSnapshot(ctx context.Context, name string, data io.Reader, size int64) error {
+	conn, release, err := u.connection(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	fileName := path.Join(u.path, name)
+	dir := path.Dir(fileName)
+	if path.Dir(name) != "." {
+		if err := conn.MkdirAll(dir); err != nil {
+			return err
+		}
+	}
+
+	tempFileName := path.Join(dir, "."+path.Base(fileName)+tempFileSuffix)
+	if err := u.writeFile(conn, tempFileName, data, size); err != nil {
+		_ = conn.Remove(tempFileName)
+		return err
+	}
+
+	if err := conn.PosixRename(tempFileName, fileName); err != nil {
+		_ = conn.Remove(tempFileName)
+		return err
+	}
+
+	return nil
+}
+
+// writeFile writes the data to the file with the given name.
+// If size is not negative, writeFile fails if the number of bytes written does not match size
+func (u *sftpStorageImpl) writeFile(conn *sftpConnection, name string, data io.Reader, size int64) error {
+	file, err := conn.Create(name)
+	if err != nil {
+		return err
+	}
+
+	written, err := io.Copy(file, data)
+	if err == nil && size >= 0 && written != size {
+		err = fmt.Errorf("incomplete write of %s: wrote %d of %d bytes", name, written, size)
+	}
+
+	return multierr.Append(err, file.Close())
+}
+
+// nolint:unused
+// implements interface storage
+func (u *sftpStorageImpl) deleteSnapshot(ctx context.Context, snapshot os.FileInfo) error {
+	conn, release, err := u.connection(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if err := conn.Remove(path.Join(u.path, snapshot.Name())); err != nil {
+		return err
+	}
+
+	deleteEmptyParents(snapshot.Name(), func(dir string) error {
+		return conn.RemoveDirectory(path.Join(u.path, dir))
+	})
+
+	return nil
+}
+
+// nolint:unused
+// implements interface storage
+func (u *sftpStorageImpl) listSnapshots(ctx context.Context, prefix string, suffix string, recursive bool) ([]os.FileInfo, error) {
+	conn, release, err := u.connection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if recursive {
+		return u.walkSnapshots(conn, prefix, suffix)
+	}
+
+	files, err := conn.ReadDir(u.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []os.FileInfo
+	for _, file := range files {
+		if !file.IsDir() && strings.HasPrefix(file.Name(), prefix) && strings.HasSuffix(file.Name(), suffix) && !isTempFile(file.Name()) {
+			snapshots = append(snapshots, file)
+		}
+	}
+
+	return snapshots, nil
+}
+
+// walkSnapshots lists the snapshots in the path and its sub-directories
+func (u *sftpStorageImpl) walkSnapshots(conn *sftpConnection, prefix string, suffix string) ([]os.FileInfo, error) {
+	var snapshots []os.FileInfo
+
+	walker := conn.Walk(u.path)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return nil, err
+		}
+
+		file := walker.Stat()
+		if file.IsDir() || !strings.HasPrefix(file.Name(), prefix) || !strings.HasSuffix(file.Name(), suffix) || isTempFile(file.Name()) {
+			continue
+		}
+
+		name := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), u.path), "/")
+		snapshots = append(snapshots, nestedFileInfo{file, name})
+	}
+
+	return snapshots, nil
+}
+
+// nolint:unused
+// implements interface storage
+func (u *sftpStorageImpl) downloadSnapshot(ctx context.Context, snapshot os.FileInfo) (io.ReadCloser, error) {
+	conn, release, err := u.connection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := conn.Open(path.Join(u.path, snapshot.Name()))
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	return &readCloser{file, func() error { release(); return nil }}, nil
+}
+
+// nolint:unused
+// implements interface storage
+func (u *sftpStorageImpl) getName(snapshot os.FileInfo) string {
+	return snapshot.Name()
+}
+
+// nolint:unused
+// implements interface storage
+func (u *sftpStorageImpl) getLastModifiedTime(snapshot os.FileInfo) time.Time {
+	return snapshot.ModTime()
+}
+
+// nolint:unused
+// implements interface storage
+func (u *sftpStorageImpl) getSize(snapshot os.FileInfo) int64 {
+	return snapshot.Size()
+}
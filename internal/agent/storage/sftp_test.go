@@ -0,0 +1,271 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/config/secret"
+	"github.com/stretchr/testify/assert"
+	"github.com/thoas/go-funk"
+	"io"
+	"net"
+	"os"
+	"path"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSFTPUploadSnapshotCreatesFile(t *testing.T) {
+	impl := newSFTPStorageStub(t)
+	snapshotData := []byte("test")
+
+	err := impl.uploadSnapshot(context.Background(), "test.snap", bytes.NewReader(snapshotData), int64(len(snapshotData)))
+	assert.NoError(t, err, "uploadSnapshot() failed unexpectedly!")
+
+	backupData, err := os.ReadFile(fmt.Sprintf("%s/test.snap", impl.path))
+	assert.NoError(t, err, "could not read uploaded snapshot")
+	assert.Equal(t, snapshotData, backupData)
+}
+
+func TestSFTPUploadSnapshotFailsIfConnectionFails(t *testing.T) {
+	impl := &sftpStorageImpl{
+		connect: func(context.Context) (*sftpConnection, error) {
+			return nil, errors.New("connection failed")
+		},
+	}
+
+	err := impl.uploadSnapshot(context.Background(), "test.snap", &bytes.Buffer{}, 0)
+	assert.Error(t, err, "uploadSnapshot() should fail if connection fails!")
+}
+
+func TestSFTPUploadSnapshotRemovesTempFileIfUploadFails(t *testing.T) {
+	impl := newSFTPStorageStub(t)
+	snapshotData := []byte("test")
+
+	err := impl.uploadSnapshot(context.Background(), "test.snap", bytes.NewReader(snapshotData), int64(len(snapshotData)))
+	assert.NoError(t, err, "uploadSnapshot() failed unexpectedly!")
+
+	err = impl.uploadSnapshot(context.Background(), "test.snap", iotest.ErrReader(errors.New("read failed")), -1)
+	assert.Error(t, err, "uploadSnapshot() should fail if data could not be read")
+
+	err = impl.uploadSnapshot(context.Background(), "other.snap", bytes.NewReader(snapshotData), 5)
+	assert.Error(t, err, "uploadSnapshot() should fail if size does not match")
+
+	files, err := os.ReadDir(impl.path)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1, "neither incomplete snapshots nor temporary files should remain")
+
+	backupData, err := os.ReadFile(fmt.Sprintf("%s/test.snap", impl.path))
+	assert.NoError(t, err, "could not read uploaded snapshot")
+	assert.Equal(t, snapshotData, backupData)
+}
+
+func TestSFTPListSnapshotsIgnoresTempFiles(t *testing.T) {
+	impl := newSFTPStorageStub(t)
+	assert.NoError(t, os.WriteFile(fmt.Sprintf("%s/.test.snap%s", impl.path, tempFileSuffix), []byte("test"), 0600))
+	assert.NoError(t, os.MkdirAll(fmt.Sprintf("%s/nested", impl.path), 0700))
+	assert.NoError(t, os.WriteFile(fmt.Sprintf("%s/nested/.test.snap%s", impl.path, tempFileSuffix), []byte("test"), 0600))
+
+	for _, recursive := range []bool{false, true} {
+		snapshots, err := impl.listSnapshots(context.Background(), ".test", tempFileSuffix, recursive)
+		assert.NoError(t, err, "listSnapshots() failed unexpectedly!")
+		assert.Empty(t, snapshots)
+	}
+}
+
+func TestSFTPReusesConnectionUntilClosed(t *testing.T) {
+	impl := newSFTPStorageStub(t)
+	connect := impl.connect
+	connections := 0
+	impl.connect = func(ctx context.Context) (*sftpConnection, error) {
+		connections++
+		return connect(ctx)
+	}
+
+	ctx := context.Background()
+	assert.NoError(t, impl.uploadSnapshot(ctx, "test.snap", bytes.NewReader([]byte("test")), 4))
+	snapshots, err := impl.listSnapshots(ctx, "test", ".snap", false)
+	assert.NoError(t, err, "listSnapshots() failed unexpectedly!")
+	assert.NoError(t, impl.deleteSnapshot(ctx, snapshots[0]))
+	assert.Equal(t, 1, connections)
+
+	assert.NoError(t, impl.Close())
+	_, err = impl.listSnapshots(ctx, "test", ".snap", false)
+	assert.NoError(t, err, "listSnapshots() failed unexpectedly!")
+	assert.Equal(t, 2, connections)
+	assert.NoError(t, impl.Close())
+}
+
+func TestSFTPClosesConnectionWhenContextIsDone(t *testing.T) {
+	impl := newSFTPStorageStub(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	conn, release, err := impl.connection(ctx)
+	assert.NoError(t, err, "connection() failed unexpectedly!")
+	defer release()
+
+	cancel()
+	assert.Eventually(t, func() bool {
+		impl.lock.Lock()
+		defer impl.lock.Unlock()
+		return impl.conn == nil
+	}, time.Second, 10*time.Millisecond)
+
+	_, err = conn.Getwd()
+	assert.Error(t, err, "connection should be closed when context is done")
+}
+
+func TestSFTPConnectAbortsStalledHandshake(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err, "could not listen")
+	defer listener.Close()
+
+	go func() {
+		// accept connections but never respond
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	config := &ssh.ClientConfig{User: "test", HostKeyCallback: ssh.InsecureIgnoreHostKey(), Timeout: time.Minute}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = connectSFTP(ctx, listener.Addr().String(), config)
+	assert.Error(t, err, "connectSFTP() should fail for stalled handshake")
+	assert.Less(t, time.Since(start), 10*time.Second)
+}
+
+func TestSFTPListSnapshotsFiltersByPrefixAndSuffix(t *testing.T) {
+	impl := newSFTPStorageStub(t)
+
+	var expectedSnapshotNames []string
+	for i := 0; i < 3; i++ {
+		expectedSnapshotNames = append(expectedSnapshotNames, createEmptySnapshot(t, impl.path, "test", ".snap").Name())
+	}
+	createEmptySnapshot(t, impl.path, "other", ".snap")
+	createEmptySnapshot(t, impl.path, "test", ".other")
+	assert.NoError(t, os.Mkdir(fmt.Sprintf("%s/test-dir.snap", impl.path), 0700))
+
+	listedSnapshots, err := impl.listSnapshots(context.Background(), "test", ".snap", false)
+	assert.NoError(t, err, "listSnapshots() failed unexpectedly!")
+
+	listedSnapshotNames := funk.Map(listedSnapshots, func(s os.FileInfo) string { return impl.getName(s) })
+	assert.ElementsMatch(t, expectedSnapshotNames, listedSnapshotNames)
+}
+
+func TestSFTPDeleteSnapshot(t *testing.T) {
+	impl := newSFTPStorageStub(t)
+
+	snapshot := createEmptySnapshot(t, impl.path, "test", ".snap")
+
+	err := impl.deleteSnapshot(context.Background(), snapshot)
+	assert.NoError(t, err, "deleteSnapshot() failed unexpectedly!")
+
+	_, err = os.Stat(fmt.Sprintf("%s/%s", impl.path, snapshot.Name()))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestSFTPDownloadSnapshot(t *testing.T) {
+	impl := newSFTPStorageStub(t)
+	snapshotData := []byte("test")
+
+	err := impl.uploadSnapshot(context.Background(), "test.snap", bytes.NewReader(snapshotData), int64(len(snapshotData)))
+	assert.NoError(t, err, "uploadSnapshot() failed unexpectedly!")
+
+	snapshots, err := impl.listSnapshots(context.Background(), "test", ".snap", false)
+	assert.NoError(t, err, "listSnapshots() failed unexpectedly!")
+	assert.Len(t, snapshots, 1)
+	assert.Equal(t, int64(len(snapshotData)), impl.getSize(snapshots[0]))
+
+	reader, err := impl.downloadSnapshot(context.Background(), snapshots[0])
+	assert.NoError(t, err, "downloadSnapshot() failed unexpectedly!")
+	defer reader.Close()
+
+	downloadedData, err := io.ReadAll(reader)
+	assert.NoError(t, err, "could not read downloaded snapshot")
+	assert.Equal(t, snapshotData, downloadedData)
+}
+
+func TestSFTPUploadListAndDeleteSnapshotInSubDirectory(t *testing.T) {
+	impl := newSFTPStorageStub(t)
+
+	err := impl.uploadSnapshot(context.Background(), "2024/01/02/test.snap", bytes.NewReader([]byte("test")), 4)
+	assert.NoError(t, err, "uploadSnapshot() failed unexpectedly!")
+	err = impl.uploadSnapshot(context.Background(), "2024/01/03/test.snap", bytes.NewReader([]byte("test")), 4)
+	assert.NoError(t, err, "uploadSnapshot() failed unexpectedly!")
+
+	snapshots, err := impl.listSnapshots(context.Background(), "test", ".snap", true)
+	assert.NoError(t, err, "listSnapshots() failed unexpectedly!")
+
+	listedSnapshotNames := funk.Map(snapshots, func(s os.FileInfo) string { return impl.getName(s) })
+	assert.ElementsMatch(t, []string{"2024/01/02/test.snap", "2024/01/03/test.snap"}, listedSnapshotNames)
+
+	assert.NoError(t, impl.deleteSnapshot(context.Background(), snapshots[0]), "deleteSnapshot() failed unexpectedly!")
+
+	_, err = os.Stat(fmt.Sprintf("%s/%s", impl.path, path.Dir(impl.getName(snapshots[0]))))
+	assert.ErrorIs(t, err, os.ErrNotExist, "empty directory should have been deleted")
+	_, err = os.Stat(fmt.Sprintf("%s/%s", impl.path, impl.getName(snapshots[1])))
+	assert.NoError(t, err, "other snapshot should not have been deleted")
+}
+
+func TestSFTPRequiresPasswordOrPrivateKey(t *testing.T) {
+	_, err := createSSHAuthMethods(SFTPStorageConfig{})
+	assert.Error(t, err, "createSSHAuthMethods() should fail without password and private key")
+
+	auth, err := createSSHAuthMethods(SFTPStorageConfig{Password: secret.FromString("test")})
+	assert.NoError(t, err, "createSSHAuthMethods() failed unexpectedly")
+	assert.Len(t, auth, 1)
+
+	_, err = createSSHAuthMethods(SFTPStorageConfig{PrivateKey: secret.FromString("invalid")})
+	assert.Error(t, err, "createSSHAuthMethods() should fail for invalid private key")
+}
+
+// newSFTPStorageStub creates a sftpStorageImpl connected to an in-process sftp-server serving a temporary directory
+func newSFTPStorageStub(t *testing.T) *sftpStorageImpl {
+	t.Helper()
+
+	return &sftpStorageImpl{
+		connect: func(context.Context) (*sftpConnection, error) {
+			serverReader, clientWriter := io.Pipe()
+			clientReader, serverWriter := io.Pipe()
+
+			server, err := sftp.NewServer(&pipeConnection{serverReader, serverWriter})
+			if err != nil {
+				return nil, err
+			}
+			go func() {
+				_ = server.Serve()
+				_ = server.Close()
+			}()
+
+			client, err := sftp.NewClientPipe(clientReader, clientWriter)
+			if err != nil {
+				return nil, err
+			}
+
+			return &sftpConnection{client, server}, nil
+		},
+		path: t.TempDir(),
+	}
+}
+
+type pipeConnection struct {
+	*io.PipeReader
+	*io.PipeWriter
+}
+
+func (c *pipeConnection) Close() error {
+	_ = c.PipeReader.Close()
+	return c.PipeWriter.Close()
+}
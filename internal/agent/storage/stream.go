@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/logging"
+	"go.uber.org/multierr"
+	"io"
+	"sync"
+	"time"
+)
+
+// StreamSnapshot uploads the snapshot read from the given reader to all storages at the same time without buffering it
+// and returns the time the next snapshot should be taken and the number of bytes read.
+// The snapshot is passed to verify while it is uploaded; the metadata returned by verify is recorded in the manifests
+// and if verify fails, the uploads fail before they are completed and its error is returned. As the snapshot can only be read once, failed
+// uploads are not retried, the concurrency-limit does not apply and the slowest storage determines the speed of all
+// uploads.
+// Failures of single storages do not prevent the upload to the others; they are returned as combined error
+func (m *Manager) StreamSnapshot(ctx context.Context, snapshot io.Reader, timestamp time.Time, verify func(io.Reader) (SnapshotMetadata, error), defaults StorageConfigDefaults) (time.Time, int64, error) {
+	verification := &streamVerification{done: make(chan struct{})}
+	verifier := newStreamBranch(nil)
+	go func() {
+		verification.complete(verify(verifier))
+		verifier.abandon()
+	}()
+
+	branches := []*streamBranch{verifier}
+	results := make([]uploadResult, len(m.factories))
+
+	var wg sync.WaitGroup
+	for i, factory := range m.factories {
+		branch := newStreamBranch(verification)
+		branches = append(branches, branch)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer branch.abandon()
+
+			results[i] = streamToStorage(ctx, factory, branch, timestamp, defaults)
+		}()
+	}
+
+	size, err := fanOut(snapshot, branches)
+	wg.Wait()
+	<-verification.done
+
+	if err != nil {
+		logging.Error("Could not read snapshot", "error", err)
+	} else if verification.err != nil {
+		err = fmt.Errorf("invalid snapshot: %w", verification.err)
+	}
+
+	nextSnapshot, errs := aggregateResults(results)
+	return nextSnapshot, size, multierr.Append(err, errs)
+}
+
+// streamToStorage uploads the given branch of a streamed snapshot to the storage created by the given factory
+// and deletes obsolete snapshots from it if the upload succeeded
+func streamToStorage(ctx context.Context, factory StorageControllerFactory, snapshot *streamBranch, timestamp time.Time, defaults StorageConfigDefaults) uploadResult {
+	controller, err := factory.CreateController(ctx)
+	if err != nil {
+		logging.Warn("Could not create storage-controller", "destination", factory.Destination(), "error", err)
+		return uploadResult{err: err}
+	}
+	defer closeController(factory, controller)
+
+	uploaded, nextSnapshot, err := controller.UploadSnapshot(ctx, snapshot, -1, timestamp, SnapshotMetadata{}, defaults)
+	return completeUpload(ctx, factory, controller, uploaded, nextSnapshot, err, defaults)
+}
+
+// fanOut copies the data read from the given reader to all branches and returns the number of bytes read.
+// Branches which are abandoned by their readers are skipped; the others receive the error of the reader, if any
+func fanOut(snapshot io.Reader, branches []*streamBranch) (int64, error) {
+	buffer := make([]byte, 32*1024)
+	size := int64(0)
+
+	for {
+		n, err := snapshot.Read(buffer)
+		if n > 0 {
+			size += int64(n)
+			for _, branch := range branches {
+				branch.write(buffer[:n])
+			}
+		}
+
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+			for _, branch := range branches {
+				_ = branch.writer.CloseWithError(err)
+			}
+			return size, err
+		}
+	}
+}
+
+// metadataSource is implemented by snapshots whose metadata is only known after they have been read completely
+type metadataSource interface {
+	metadata() SnapshotMetadata
+}
+
+// streamVerification holds the result of the verification of a streamed snapshot
+type streamVerification struct {
+	done     chan struct{}
+	metadata SnapshotMetadata
+	err      error
+}
+
+func (v *streamVerification) complete(metadata SnapshotMetadata, err error) {
+	v.metadata = metadata
+	v.err = err
+	close(v.done)
+}
+
+// wait waits for the verification to complete and returns io.EOF if the snapshot is valid
+func (v *streamVerification) wait() error {
+	<-v.done
+	if v.err != nil {
+		return fmt.Errorf("invalid snapshot: %w", v.err)
+	}
+	return io.EOF
+}
+
+// streamBranch passes the data of a streamed snapshot to a single reader.
+// If it is given a streamVerification, the end of the snapshot is only signaled after the snapshot was verified
+type streamBranch struct {
+	reader       *io.PipeReader
+	writer       *io.PipeWriter
+	verification *streamVerification
+	abandoned    bool
+}
+
+func newStreamBranch(verification *streamVerification) *streamBranch {
+	reader, writer := io.Pipe()
+	return &streamBranch{reader: reader, writer: writer, verification: verification}
+}
+
+func (b *streamBranch) Read(p []byte) (int, error) {
+	n, err := b.reader.Read(p)
+	if errors.Is(err, io.EOF) && b.verification != nil {
+		return n, b.verification.wait()
+	}
+	return n, err
+}
+
+// implements interface metadataSource
+func (b *streamBranch) metadata() SnapshotMetadata {
+	<-b.verification.done
+	return b.verification.metadata
+}
+
+// write passes the given data to the reader of the branch unless it has abandoned the branch
+func (b *streamBranch) write(p []byte) {
+	if b.abandoned {
+		return
+	}
+
+	if _, err := b.writer.Write(p); err != nil {
+		b.abandoned = true
+	}
+}
+
+// abandon signals that the reader does not read any more data from the branch
+func (b *streamBranch) abandon() {
+	_ = b.reader.CloseWithError(errors.New("snapshot-stream abandoned"))
+}
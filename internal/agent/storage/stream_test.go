@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestStreamSnapshotUploadsToAllControllers(t *testing.T) {
+	controller1 := &storageControllerStub{nextSnapshot: time.Now().Add(time.Millisecond * 2)}
+	controller2 := &storageControllerStub{nextSnapshot: time.Now().Add(time.Millisecond)}
+	manager := Manager{
+		factories: []StorageControllerFactory{
+			storageControllerFactoryStub{controller: controller1},
+			storageControllerFactoryStub{controller: controller2},
+		},
+	}
+
+	data := strings.Repeat("test", 100000)
+	var verified string
+	verify := func(snapshot io.Reader) (SnapshotMetadata, error) {
+		content, err := io.ReadAll(snapshot)
+		verified = string(content)
+		return SnapshotMetadata{}, err
+	}
+
+	nextSnapshot, size, err := manager.StreamSnapshot(context.Background(), strings.NewReader(data), controller1.nextSnapshot, verify, StorageConfigDefaults{})
+	assert.NoError(t, err, "StreamSnapshot failed unexpectedly")
+
+	assert.Equal(t, int64(len(data)), size)
+	assert.Equal(t, data, verified)
+	assert.Equal(t, data, controller1.uploadData)
+	assert.Equal(t, data, controller2.uploadData)
+	assert.Equal(t, controller2.nextSnapshot, nextSnapshot)
+	assert.Equal(t, StorageConfigDefaults{}, controller1.deleteDefaults)
+}
+
+func TestStreamSnapshotIgnoresSkippedUploads(t *testing.T) {
+	skipping := &storageControllerStub{nextSnapshot: time.Now().Add(time.Hour)}
+	uploading := &storageControllerStub{}
+	manager := Manager{
+		factories: []StorageControllerFactory{
+			storageControllerFactoryStub{controller: skipping},
+			storageControllerFactoryStub{controller: uploading},
+		},
+	}
+
+	data := strings.Repeat("test", 100000)
+	verify := func(snapshot io.Reader) (SnapshotMetadata, error) {
+		_, err := io.Copy(io.Discard, snapshot)
+		return SnapshotMetadata{}, err
+	}
+
+	_, _, err := manager.StreamSnapshot(context.Background(), strings.NewReader(data), time.Now(), verify, StorageConfigDefaults{})
+	assert.NoError(t, err, "StreamSnapshot failed unexpectedly")
+
+	assert.Empty(t, skipping.uploadData)
+	assert.Equal(t, data, uploading.uploadData)
+}
+
+func TestStreamSnapshotFailsUploadsIfVerificationFails(t *testing.T) {
+	controller := &storageControllerStub{}
+	manager := Manager{
+		factories: []StorageControllerFactory{
+			storageControllerFactoryStub{controller: controller},
+		},
+	}
+
+	verify := func(io.Reader) (SnapshotMetadata, error) {
+		return SnapshotMetadata{}, errors.New("invalid")
+	}
+
+	_, _, err := manager.StreamSnapshot(context.Background(), strings.NewReader("test"), time.Now(), verify, StorageConfigDefaults{})
+	assert.Error(t, err, "StreamSnapshot should fail if verification fails")
+
+	assert.Empty(t, controller.uploadData)
+	assert.Zero(t, controller.deleteDefaults)
+}
+
+func TestStreamSnapshotFailsIfSnapshotCannotBeRead(t *testing.T) {
+	controller := &storageControllerStub{}
+	manager := Manager{
+		factories: []StorageControllerFactory{
+			storageControllerFactoryStub{controller: controller},
+		},
+	}
+
+	verify := func(snapshot io.Reader) (SnapshotMetadata, error) {
+		_, err := io.Copy(io.Discard, snapshot)
+		return SnapshotMetadata{}, err
+	}
+
+	snapshot := io.MultiReader(strings.NewReader("test"), iotest.ErrReader(errors.New("read failed")))
+	_, size, err := manager.StreamSnapshot(context.Background(), snapshot, time.Now(), verify, StorageConfigDefaults{})
+	assert.Error(t, err, "StreamSnapshot should fail if snapshot cannot be read")
+
+	assert.Equal(t, int64(4), size)
+	assert.Empty(t, controller.uploadData)
+}
+
+func TestUploadSnapshotRecordsMetadataOfStreamedSnapshotInManifest(t *testing.T) {
+	storage := &storageStub{}
+	controller := &storageControllerImpl[time.Time]{
+		config:  StorageControllerConfig{NameSuffix: ".test"},
+		storage: storage,
+	}
+
+	metadata := SnapshotMetadata{Node: "http://node", RaftIndex: 10, RaftTerm: 2, AgentVersion: "test-version"}
+	verification := &streamVerification{done: make(chan struct{})}
+	branch := newStreamBranch(verification)
+	go func() {
+		_, _ = fanOut(strings.NewReader("test"), []*streamBranch{branch})
+		verification.complete(metadata, nil)
+	}()
+
+	uploaded, _, err := controller.UploadSnapshot(context.Background(), branch, -1, time.Now(), SnapshotMetadata{}, StorageConfigDefaults{})
+	assert.NoError(t, err, "UploadSnapshot failed unexpectedly")
+	assert.True(t, uploaded)
+
+	manifest := SnapshotManifest{}
+	assert.NoError(t, json.Unmarshal([]byte(storage.manifestData), &manifest), "could not read uploaded manifest")
+	assert.Equal(t, metadata, manifest.SnapshotMetadata)
+	assert.Equal(t, int64(4), manifest.Size)
+}
@@ -28,7 +28,7 @@ type swiftStorageImpl struct {
 }
 
 func (conf SwiftStorageConfig) Destination() string {
-	return fmt.Sprintf("swift container %s", conf.Container)
+	return conf.describeDestination(fmt.Sprintf("swift container %s at %s", conf.Container, conf.AuthUrl))
 }
 
 func (conf SwiftStorageConfig) CreateController(ctx context.Context) (StorageController, error) {
@@ -116,12 +116,35 @@ func (u swiftStorageImpl) deleteSnapshot(ctx context.Context, snapshot swift.Obj
 
 // nolint:unused
 // implements interface storage
-func (u swiftStorageImpl) listSnapshots(ctx context.Context, prefix string, _ string) ([]swift.Object, error) {
+func (u swiftStorageImpl) listSnapshots(ctx context.Context, prefix string, _ string, _ bool) ([]swift.Object, error) {
 	return u.conn.ObjectsAll(ctx, u.container, &swift.ObjectsOpts{Prefix: prefix})
 }
 
+// nolint:unused
+// implements interface storage
+func (u swiftStorageImpl) downloadSnapshot(ctx context.Context, snapshot swift.Object) (io.ReadCloser, error) {
+	file, _, err := u.conn.ObjectOpen(ctx, u.container, snapshot.Name, false, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// nolint:unused
+// implements interface storage
+func (u swiftStorageImpl) getName(snapshot swift.Object) string {
+	return snapshot.Name
+}
+
 // nolint:unused
 // implements interface storage
 func (u swiftStorageImpl) getLastModifiedTime(snapshot swift.Object) time.Time {
 	return snapshot.LastModified
 }
+
+// nolint:unused
+// implements interface storage
+func (u swiftStorageImpl) getSize(snapshot swift.Object) int64 {
+	return snapshot.Bytes
+}
@@ -0,0 +1,432 @@
+package storage
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/config/secret"
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/logging"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type WebDAVStorageConfig struct {
+	StorageControllerConfig `mapstructure:",squash"`
+	Url                     string        `validate:"required,http_url"`
+	Username                secret.Secret `default:"env://WEBDAV_USERNAME"`
+	Password                secret.Secret `default:"env://WEBDAV_PASSWORD"`
+	BearerToken             secret.Secret `default:"env://WEBDAV_BEARER_TOKEN"`
+	CACert                  secret.Secret
+}
+
+type webDAVStorageImpl struct {
+	client        *http.Client
+	url           *url.URL
+	authorization string
+}
+
+// webDAVFile describes a file or collection listed by a PROPFIND-request
+type webDAVFile struct {
+	name         string
+	lastModified time.Time
+	size         int64
+	collection   bool
+}
+
+// propfindRequest requests the properties required by webDAVStorageImpl
+const propfindRequest = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:">
+  <d:prop>
+    <d:getlastmodified/>
+    <d:getcontentlength/>
+    <d:resourcetype/>
+  </d:prop>
+</d:propfind>`
+
+// multistatus is the response to a PROPFIND-request
+type multistatus struct {
+	Responses []struct {
+		Href     string `xml:"DAV: href"`
+		Propstat []struct {
+			Prop struct {
+				LastModified  string `xml:"DAV: getlastmodified"`
+				ContentLength string `xml:"DAV: getcontentlength"`
+				ResourceType  struct {
+					Collection *struct{} `xml:"DAV: collection"`
+				} `xml:"DAV: resourcetype"`
+			} `xml:"DAV: prop"`
+			Status string `xml:"DAV: status"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+func (conf WebDAVStorageConfig) Destination() string {
+	return conf.describeDestination(fmt.Sprintf("webdav collection %s", conf.Url))
+}
+
+func (conf WebDAVStorageConfig) CreateController(ctx context.Context) (StorageController, error) {
+	impl, err := conf.createStorage()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := impl.propfind(ctx, "", "0"); err != nil {
+		_ = impl.Close()
+		return nil, fmt.Errorf("invalid collection %s: %s", conf.Url, err)
+	}
+
+	return newStorageController[webDAVFile](conf.StorageControllerConfig, impl), nil
+}
+
+func (conf WebDAVStorageConfig) createStorage() (webDAVStorageImpl, error) {
+	collection, err := url.Parse(conf.Url)
+	if err != nil {
+		return webDAVStorageImpl{}, err
+	}
+
+	if !strings.HasSuffix(collection.Path, "/") {
+		collection.Path += "/"
+	}
+
+	authorization, err := conf.authorization()
+	if err != nil {
+		return webDAVStorageImpl{}, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	caCert, err := conf.CACert.Resolve(false)
+	if err != nil {
+		return webDAVStorageImpl{}, err
+	}
+
+	if caCert != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(caCert)) {
+			return webDAVStorageImpl{}, errors.New("invalid ca-certificate")
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	return webDAVStorageImpl{
+		client:        &http.Client{Transport: transport},
+		url:           collection,
+		authorization: authorization,
+	}, nil
+}
+
+func (conf WebDAVStorageConfig) authorization() (string, error) {
+	token, err := conf.BearerToken.Resolve(false)
+	if err != nil {
+		return "", err
+	}
+
+	if token != "" {
+		return "Bearer " + token, nil
+	}
+
+	username, err := conf.Username.Resolve(false)
+	if err != nil {
+		return "", err
+	}
+
+	if username == "" {
+		return "", nil
+	}
+
+	password, err := conf.Password.Resolve(true)
+	if err != nil {
+		return "", err
+	}
+
+	request := http.Request{Header: http.Header{}}
+	request.SetBasicAuth(username, password)
+	return request.Header.Get("Authorization"), nil
+}
+
+// Close closes the idle connections of the storage's transport
+func (u webDAVStorageImpl) Close() error {
+	u.client.CloseIdleConnections()
+	return nil
+}
+
+// nolint:unused
+// implements interface storage
+func (u webDAVStorageImpl) uploadSnapshot(ctx context.Context, name string, data io.Reader, size int64) error {
+	if err := u.createCollection(ctx, path.Dir(name)); err != nil {
+		return err
+	}
+
+	request, err := u.newRequest(ctx, http.MethodPut, name, data)
+	if err != nil {
+		return err
+	}
+
+	if size >= 0 {
+		request.ContentLength = size
+	}
+
+	body, err := u.do(request, http.StatusOK, http.StatusCreated, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	return body.Close()
+}
+
+// nolint:unused
+// implements interface storage
+func (u webDAVStorageImpl) deleteSnapshot(ctx context.Context, snapshot webDAVFile) error {
+	request, err := u.newRequest(ctx, http.MethodDelete, snapshot.name, nil)
+	if err != nil {
+		return err
+	}
+
+	body, err := u.do(request, http.StatusOK, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+
+	if err := body.Close(); err != nil {
+		return err
+	}
+
+	deleteEmptyParents(snapshot.name, func(dir string) error {
+		return u.deleteEmptyCollection(ctx, dir)
+	})
+
+	return nil
+}
+
+// nolint:unused
+// implements interface storage
+func (u webDAVStorageImpl) listSnapshots(ctx context.Context, prefix string, suffix string, recursive bool) ([]webDAVFile, error) {
+	files, err := u.propfind(ctx, "", "1")
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []webDAVFile
+	for len(files) > 0 {
+		file := files[0]
+		files = files[1:]
+
+		if file.collection {
+			if recursive {
+				nested, err := u.propfind(ctx, file.name, "1")
+				if err != nil {
+					return nil, err
+				}
+				files = append(files, nested...)
+			}
+			continue
+		}
+
+		if strings.HasPrefix(path.Base(file.name), prefix) && strings.HasSuffix(file.name, suffix) {
+			snapshots = append(snapshots, file)
+		}
+	}
+
+	return snapshots, nil
+}
+
+// nolint:unused
+// implements interface storage
+func (u webDAVStorageImpl) downloadSnapshot(ctx context.Context, snapshot webDAVFile) (io.ReadCloser, error) {
+	request, err := u.newRequest(ctx, http.MethodGet, snapshot.name, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.do(request, http.StatusOK)
+}
+
+// nolint:unused
+// implements interface storage
+func (u webDAVStorageImpl) getName(snapshot webDAVFile) string {
+	return snapshot.name
+}
+
+// nolint:unused
+// implements interface storage
+func (u webDAVStorageImpl) getLastModifiedTime(snapshot webDAVFile) time.Time {
+	return snapshot.lastModified
+}
+
+// nolint:unused
+// implements interface storage
+func (u webDAVStorageImpl) getSize(snapshot webDAVFile) int64 {
+	return snapshot.size
+}
+
+// createCollection creates the collection with the given name and its parents if they do not exist
+func (u webDAVStorageImpl) createCollection(ctx context.Context, name string) error {
+	if name == "." {
+		return nil
+	}
+
+	if err := u.createCollection(ctx, path.Dir(name)); err != nil {
+		return err
+	}
+
+	request, err := u.newRequest(ctx, "MKCOL", name+"/", nil)
+	if err != nil {
+		return err
+	}
+
+	// MKCOL fails with 405 Method Not Allowed if the collection already exists
+	body, err := u.do(request, http.StatusCreated, http.StatusMethodNotAllowed)
+	if err != nil {
+		return err
+	}
+	return body.Close()
+}
+
+// deleteEmptyCollection deletes the collection with the given name if it does not contain any files or collections
+func (u webDAVStorageImpl) deleteEmptyCollection(ctx context.Context, name string) error {
+	files, err := u.propfind(ctx, name, "1")
+	if err != nil {
+		return err
+	}
+
+	if len(files) > 0 {
+		return fmt.Errorf("collection %s is not empty", name)
+	}
+
+	request, err := u.newRequest(ctx, http.MethodDelete, name+"/", nil)
+	if err != nil {
+		return err
+	}
+
+	body, err := u.do(request, http.StatusOK, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	return body.Close()
+}
+
+// propfind lists the files and collections in the collection with the given name; the collection itself is omitted
+func (u webDAVStorageImpl) propfind(ctx context.Context, collection string, depth string) ([]webDAVFile, error) {
+	target := collection
+	if target != "" {
+		target += "/"
+	}
+
+	request, err := u.newRequest(ctx, "PROPFIND", target, strings.NewReader(propfindRequest))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Depth", depth)
+	request.Header.Set("Content-Type", "application/xml; charset=utf-8")
+
+	body, err := u.do(request, http.StatusMultiStatus)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	status := multistatus{}
+	if err := xml.NewDecoder(body).Decode(&status); err != nil {
+		return nil, fmt.Errorf("invalid response to PROPFIND: %s", err)
+	}
+
+	var files []webDAVFile
+	for _, response := range status.Responses {
+		name, err := u.relativeName(response.Href)
+		if err != nil {
+			return nil, err
+		}
+
+		if name == collection {
+			continue
+		}
+
+		for _, propstat := range response.Propstat {
+			if !strings.Contains(propstat.Status, " 200 ") {
+				continue
+			}
+
+			if propstat.Prop.ResourceType.Collection != nil {
+				files = append(files, webDAVFile{name: name, collection: true})
+				continue
+			}
+
+			// some servers omit the properties of files they can not determine them for; these files are skipped
+			file, err := newWebDAVFile(name, propstat.Prop.LastModified, propstat.Prop.ContentLength)
+			if err != nil {
+				logging.Warn("Skipping file with invalid properties", "file", name, "error", err)
+				continue
+			}
+			files = append(files, file)
+		}
+	}
+
+	return files, nil
+}
+
+// relativeName returns the name of the file or collection with the given href relative to the storage's collection
+func (u webDAVStorageImpl) relativeName(href string) (string, error) {
+	location, err := url.Parse(href)
+	if err != nil {
+		return "", fmt.Errorf("invalid href %s: %s", href, err)
+	}
+
+	return strings.Trim(strings.TrimPrefix(location.Path, u.url.Path), "/"), nil
+}
+
+func newWebDAVFile(name string, lastModified string, contentLength string) (webDAVFile, error) {
+	modified, err := http.ParseTime(lastModified)
+	if err != nil {
+		return webDAVFile{}, fmt.Errorf("invalid last-modified time of %s: %s", name, err)
+	}
+
+	size, err := strconv.ParseInt(contentLength, 10, 64)
+	if err != nil {
+		return webDAVFile{}, fmt.Errorf("invalid content-length of %s: %s", name, err)
+	}
+
+	return webDAVFile{name: name, lastModified: modified, size: size}, nil
+}
+
+// newRequest creates a request for the file with the given name or the collection itself if name is empty
+func (u webDAVStorageImpl) newRequest(ctx context.Context, method string, name string, body io.Reader) (*http.Request, error) {
+	target := u.url
+	if name != "" {
+		target = u.url.JoinPath(name)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.authorization != "" {
+		request.Header.Set("Authorization", u.authorization)
+	}
+
+	return request, nil
+}
+
+// do sends the request and returns the body of the response if its status is one of the expected status-codes
+func (u webDAVStorageImpl) do(request *http.Request, expectedStatus ...int) (io.ReadCloser, error) {
+	response, err := u.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, status := range expectedStatus {
+		if response.StatusCode == status {
+			return response.Body, nil
+		}
+	}
+
+	_ = response.Body.Close()
+	return nil, fmt.Errorf("%s %s failed: %s", request.Method, request.URL.Redacted(), response.Status)
+}
@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"fmt"
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/config/secret"
+	"github.com/stretchr/testify/assert"
+	"github.com/thoas/go-funk"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestWebDAVUploadSnapshotCreatesFile(t *testing.T) {
+	impl, dir := newWebDAVStorageStub(t)
+	snapshotData := []byte("test")
+
+	err := impl.uploadSnapshot(context.Background(), "test.snap", bytes.NewReader(snapshotData), int64(len(snapshotData)))
+	assert.NoError(t, err, "uploadSnapshot() failed unexpectedly!")
+
+	backupData, err := os.ReadFile(fmt.Sprintf("%s/test.snap", dir))
+	assert.NoError(t, err, "could not read uploaded snapshot")
+	assert.Equal(t, snapshotData, backupData)
+}
+
+func TestWebDAVUploadSnapshotOfUnknownSize(t *testing.T) {
+	impl, dir := newWebDAVStorageStub(t)
+	snapshotData := []byte("test")
+
+	err := impl.uploadSnapshot(context.Background(), "test.snap", io.MultiReader(bytes.NewReader(snapshotData)), -1)
+	assert.NoError(t, err, "uploadSnapshot() failed unexpectedly!")
+
+	backupData, err := os.ReadFile(fmt.Sprintf("%s/test.snap", dir))
+	assert.NoError(t, err, "could not read uploaded snapshot")
+	assert.Equal(t, snapshotData, backupData)
+}
+
+func TestWebDAVListSnapshotsFiltersByPrefixAndSuffix(t *testing.T) {
+	impl, dir := newWebDAVStorageStub(t)
+
+	var expectedSnapshotNames []string
+	for i := 0; i < 3; i++ {
+		expectedSnapshotNames = append(expectedSnapshotNames, createEmptySnapshot(t, dir, "test", ".snap").Name())
+	}
+	createEmptySnapshot(t, dir, "other", ".snap")
+	createEmptySnapshot(t, dir, "test", ".other")
+	assert.NoError(t, os.Mkdir(fmt.Sprintf("%s/test-dir.snap", dir), 0700))
+
+	listedSnapshots, err := impl.listSnapshots(context.Background(), "test", ".snap", false)
+	assert.NoError(t, err, "listSnapshots() failed unexpectedly!")
+
+	listedSnapshotNames := funk.Map(listedSnapshots, func(s webDAVFile) string { return impl.getName(s) })
+	assert.ElementsMatch(t, expectedSnapshotNames, listedSnapshotNames)
+}
+
+func TestWebDAVDeleteSnapshot(t *testing.T) {
+	impl, dir := newWebDAVStorageStub(t)
+
+	snapshot := createEmptySnapshot(t, dir, "test", ".snap")
+
+	err := impl.deleteSnapshot(context.Background(), webDAVFile{name: snapshot.Name()})
+	assert.NoError(t, err, "deleteSnapshot() failed unexpectedly!")
+
+	_, err = os.Stat(fmt.Sprintf("%s/%s", dir, snapshot.Name()))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestWebDAVDownloadSnapshot(t *testing.T) {
+	impl, _ := newWebDAVStorageStub(t)
+	snapshotData := []byte("test")
+
+	err := impl.uploadSnapshot(context.Background(), "test.snap", bytes.NewReader(snapshotData), int64(len(snapshotData)))
+	assert.NoError(t, err, "uploadSnapshot() failed unexpectedly!")
+
+	snapshots, err := impl.listSnapshots(context.Background(), "test", ".snap", false)
+	assert.NoError(t, err, "listSnapshots() failed unexpectedly!")
+	assert.Len(t, snapshots, 1)
+	assert.Equal(t, int64(len(snapshotData)), impl.getSize(snapshots[0]))
+	assert.False(t, impl.getLastModifiedTime(snapshots[0]).IsZero())
+
+	reader, err := impl.downloadSnapshot(context.Background(), snapshots[0])
+	assert.NoError(t, err, "downloadSnapshot() failed unexpectedly!")
+	defer reader.Close()
+
+	downloadedData, err := io.ReadAll(reader)
+	assert.NoError(t, err, "could not read downloaded snapshot")
+	assert.Equal(t, snapshotData, downloadedData)
+}
+
+func TestWebDAVDownloadSnapshotFailsForMissingFile(t *testing.T) {
+	impl, _ := newWebDAVStorageStub(t)
+
+	_, err := impl.downloadSnapshot(context.Background(), webDAVFile{name: "missing.snap"})
+	assert.Error(t, err, "downloadSnapshot() should fail for missing file")
+}
+
+func TestWebDAVUploadListAndDeleteSnapshotInSubCollection(t *testing.T) {
+	impl, dir := newWebDAVStorageStub(t)
+
+	err := impl.uploadSnapshot(context.Background(), "2024/01/02/test.snap", bytes.NewReader([]byte("test")), 4)
+	assert.NoError(t, err, "uploadSnapshot() failed unexpectedly!")
+	err = impl.uploadSnapshot(context.Background(), "2024/01/03/test.snap", bytes.NewReader([]byte("test")), 4)
+	assert.NoError(t, err, "uploadSnapshot() failed unexpectedly!")
+
+	snapshots, err := impl.listSnapshots(context.Background(), "test", ".snap", false)
+	assert.NoError(t, err, "listSnapshots() failed unexpectedly!")
+	assert.Empty(t, snapshots)
+
+	snapshots, err = impl.listSnapshots(context.Background(), "test", ".snap", true)
+	assert.NoError(t, err, "listSnapshots() failed unexpectedly!")
+
+	listedSnapshotNames := funk.Map(snapshots, func(s webDAVFile) string { return impl.getName(s) })
+	assert.ElementsMatch(t, []string{"2024/01/02/test.snap", "2024/01/03/test.snap"}, listedSnapshotNames)
+
+	assert.NoError(t, impl.deleteSnapshot(context.Background(), snapshots[0]), "deleteSnapshot() failed unexpectedly!")
+
+	_, err = os.Stat(fmt.Sprintf("%s/%s", dir, path.Dir(impl.getName(snapshots[0]))))
+	assert.ErrorIs(t, err, os.ErrNotExist, "empty collection should have been deleted")
+	_, err = os.Stat(fmt.Sprintf("%s/%s", dir, impl.getName(snapshots[1])))
+	assert.NoError(t, err, "other snapshot should not have been deleted")
+}
+
+func TestWebDAVSendsAuthorization(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	config := WebDAVStorageConfig{Url: server.URL, Username: secret.FromString("user"), Password: secret.FromString("pass")}
+	impl, err := config.createStorage()
+	assert.NoError(t, err, "createStorage() failed unexpectedly")
+
+	assert.NoError(t, impl.deleteSnapshot(context.Background(), webDAVFile{name: "test.snap"}))
+	assert.Equal(t, "Basic dXNlcjpwYXNz", authorization)
+
+	config.BearerToken = secret.FromString("token")
+	impl, err = config.createStorage()
+	assert.NoError(t, err, "createStorage() failed unexpectedly")
+
+	assert.NoError(t, impl.deleteSnapshot(context.Background(), webDAVFile{name: "test.snap"}))
+	assert.Equal(t, "Bearer token", authorization)
+}
+
+func TestWebDAVFailsForInvalidCACert(t *testing.T) {
+	_, err := WebDAVStorageConfig{Url: "https://localhost", CACert: secret.FromString("invalid")}.createStorage()
+	assert.Error(t, err, "createStorage() should fail for invalid ca-certificate")
+}
+
+func TestWebDAVUsesCACert(t *testing.T) {
+	server := httptest.NewTLSServer(&webdav.Handler{FileSystem: webdav.Dir(t.TempDir()), LockSystem: webdav.NewMemLS()})
+	defer server.Close()
+
+	_, err := WebDAVStorageConfig{Url: server.URL}.CreateController(context.Background())
+	assert.Error(t, err, "CreateController() should fail for untrusted server-certificate")
+
+	caCert := string(pemEncodeCertificate(server.Certificate().Raw))
+	_, err = WebDAVStorageConfig{Url: server.URL, CACert: secret.FromString(caCert)}.CreateController(context.Background())
+	assert.NoError(t, err, "CreateController() failed unexpectedly")
+}
+
+func TestWebDAVListSnapshotsSkipsFilesWithoutProperties(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMultiStatus)
+		_, _ = w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?>
+<d:multistatus xmlns:d="DAV:">
+  <d:response>
+    <d:href>/test-1.snap</d:href>
+    <d:propstat>
+      <d:prop><d:getlastmodified>Mon, 02 Jan 2006 15:04:05 GMT</d:getlastmodified><d:getcontentlength>4</d:getcontentlength></d:prop>
+      <d:status>HTTP/1.1 200 OK</d:status>
+    </d:propstat>
+  </d:response>
+  <d:response>
+    <d:href>/test-2.snap</d:href>
+    <d:propstat>
+      <d:prop><d:getlastmodified>Mon, 02 Jan 2006 15:04:05 GMT</d:getlastmodified></d:prop>
+      <d:status>HTTP/1.1 200 OK</d:status>
+    </d:propstat>
+  </d:response>
+</d:multistatus>`))
+	}))
+	defer server.Close()
+
+	impl, err := WebDAVStorageConfig{Url: server.URL}.createStorage()
+	assert.NoError(t, err, "createStorage() failed unexpectedly")
+
+	snapshots, err := impl.listSnapshots(context.Background(), "test", ".snap", false)
+	assert.NoError(t, err, "listSnapshots() failed unexpectedly")
+	assert.Equal(t, []string{"test-1.snap"}, funk.Map(snapshots, func(s webDAVFile) string { return impl.getName(s) }))
+}
+
+func TestWebDAVCloseClosesIdleConnections(t *testing.T) {
+	closed := make(chan struct{}, 1)
+	server := httptest.NewUnstartedServer(&webdav.Handler{FileSystem: webdav.Dir(t.TempDir()), LockSystem: webdav.NewMemLS()})
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			closed <- struct{}{}
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	controller, err := WebDAVStorageConfig{Url: server.URL}.CreateController(context.Background())
+	assert.NoError(t, err, "CreateController() failed unexpectedly")
+	assert.NoError(t, controller.Close(), "Close() failed unexpectedly")
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		assert.Fail(t, "idle connection should have been closed")
+	}
+}
+
+// newWebDAVStorageStub creates a webDAVStorageImpl connected to an in-process webdav-server serving a temporary directory
+func newWebDAVStorageStub(t *testing.T) (webDAVStorageImpl, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	server := httptest.NewServer(&webdav.Handler{FileSystem: webdav.Dir(dir), LockSystem: webdav.NewMemLS()})
+	t.Cleanup(server.Close)
+
+	impl, err := WebDAVStorageConfig{Url: server.URL + "/"}.createStorage()
+	assert.NoError(t, err, "createStorage() failed unexpectedly")
+
+	return impl, dir
+}
+
+func pemEncodeCertificate(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
@@ -1,10 +1,23 @@
 package test
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
+	"math/big"
 	"os"
+	"path/filepath"
 	"runtime"
 	"testing"
+	"time"
 )
 
 func WriteFile(t *testing.T, dest string, contents string) error {
@@ -25,3 +38,73 @@ func WriteFile(t *testing.T, dest string, contents string) error {
 func PtrTo[T any](v T) *T {
 	return &v
 }
+
+// RaftSnapshot creates a gzipped tar-archive containing the given raft-state like a snapshot created by vault
+func RaftSnapshot(t *testing.T, state string) []byte {
+	t.Helper()
+
+	meta := fmt.Sprintf(`{"Version":1,"ID":"2-10-1700000000000","Index":10,"Term":2,"Size":%d}`, len(state))
+	checksums := fmt.Sprintf("%x  meta.json\n%x  state.bin\n", sha256.Sum256([]byte(meta)), sha256.Sum256([]byte(state)))
+
+	buffer := &bytes.Buffer{}
+	gz := gzip.NewWriter(buffer)
+	archive := tar.NewWriter(gz)
+
+	for _, file := range [][2]string{{"meta.json", meta}, {"state.bin", state}, {"SHA256SUMS", checksums}} {
+		if err := archive.WriteHeader(&tar.Header{Name: file[0], Mode: 0600, Size: int64(len(file[1]))}); err != nil {
+			t.Fatalf("could not write raft-snapshot: %s", err)
+		}
+		if _, err := archive.Write([]byte(file[1])); err != nil {
+			t.Fatalf("could not write raft-snapshot: %s", err)
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		t.Fatalf("could not write raft-snapshot: %s", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("could not write raft-snapshot: %s", err)
+	}
+
+	return buffer.Bytes()
+}
+
+// WriteCertificate writes a self-signed certificate and its private key as PEM-files to the given directory
+// and returns the paths of both files
+func WriteCertificate(t *testing.T, dir string, name string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate key: %s", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("could not create certificate: %s", err)
+	}
+
+	keyData, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("could not marshal key: %s", err)
+	}
+
+	certFile := filepath.Join(dir, name+".pem")
+	keyFile := filepath.Join(dir, name+"-key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), 0600); err != nil {
+		t.Fatalf("could not write certificate: %s", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyData}), 0600); err != nil {
+		t.Fatalf("could not write key: %s", err)
+	}
+
+	return certFile, keyFile
+}
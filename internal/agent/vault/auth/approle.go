@@ -7,9 +7,10 @@ import (
 )
 
 type AppRoleAuthConfig struct {
-	Path     string        `default:"approle"`
-	RoleId   secret.Secret `mapstructure:"role" validate:"required"`
-	SecretId secret.Secret `mapstructure:"secret" validate:"required"`
+	Path      string `default:"approle"`
+	Namespace string
+	RoleId    secret.Secret `mapstructure:"role" validate:"required"`
+	SecretId  secret.Secret `mapstructure:"secret" validate:"required"`
 }
 
 func (c AppRoleAuthConfig) createAuthMethod() (api.AuthMethod, error) {
@@ -11,6 +11,7 @@ import (
 
 type VaultAuth interface {
 	Refresh(context.Context, *api.Client, bool) error
+	Revoke(context.Context, *api.Client) error
 }
 
 type vaultAuthMethodFactory interface {
@@ -18,48 +19,115 @@ type vaultAuthMethodFactory interface {
 }
 
 type vaultAuthImpl struct {
-	factory vaultAuthMethodFactory
-	expires time.Time
+	factory   vaultAuthMethodFactory
+	namespace string
+	static    bool
+	token     string
+	ttl       time.Duration
+	renewable bool
+	expires   time.Time
 }
 
-func CreateVaultAuth(config VaultAuthConfig) (VaultAuth, error) {
+// CreateVaultAuth creates the VaultAuth configured by the given VaultAuthConfig.
+// The auth-method logs in to the namespace configured for it or to the given default namespace
+func CreateVaultAuth(config VaultAuthConfig, namespace string) (VaultAuth, error) {
 	if config.AppRole != nil {
-		return &vaultAuthImpl{factory: config.AppRole}, nil
+		return newVaultAuth(config.AppRole, config.AppRole.Namespace, namespace), nil
 	} else if config.AWS != nil {
-		return &vaultAuthImpl{factory: config.AWS}, nil
+		return newVaultAuth(config.AWS, config.AWS.Namespace, namespace), nil
 	} else if config.Azure != nil {
-		return &vaultAuthImpl{factory: config.Azure}, nil
+		return newVaultAuth(config.Azure, config.Azure.Namespace, namespace), nil
+	} else if config.Cert != nil {
+		return newVaultAuth(config.Cert, config.Cert.Namespace, namespace), nil
 	} else if config.GCP != nil {
-		return &vaultAuthImpl{factory: config.GCP}, nil
+		return newVaultAuth(config.GCP, config.GCP.Namespace, namespace), nil
+	} else if config.JWT != nil {
+		return newVaultAuth(config.JWT, config.JWT.Namespace, namespace), nil
 	} else if config.Kubernetes != nil {
-		return &vaultAuthImpl{factory: config.Kubernetes}, nil
+		return newVaultAuth(config.Kubernetes, config.Kubernetes.Namespace, namespace), nil
 	} else if config.LDAP != nil {
-		return &vaultAuthImpl{factory: config.LDAP}, nil
+		return newVaultAuth(config.LDAP, config.LDAP.Namespace, namespace), nil
 	} else if config.UserPass != nil {
-		return &vaultAuthImpl{factory: config.UserPass}, nil
+		return newVaultAuth(config.UserPass, config.UserPass.Namespace, namespace), nil
 	} else if config.Token != nil {
-		return &vaultAuthImpl{factory: config.Token}, nil
+		auth := newVaultAuth(config.Token, "", namespace)
+		// configured tokens are renewed but never revoked as they are managed outside the agent
+		auth.static = true
+		return auth, nil
 	} else {
 		return nil, fmt.Errorf("unknown authenticatin method")
 	}
 }
 
+func newVaultAuth(factory vaultAuthMethodFactory, namespace string, defaultNamespace string) *vaultAuthImpl {
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+	return &vaultAuthImpl{factory: factory, namespace: namespace}
+}
+
+// Refresh ensures that the given client uses a valid token.
+// Renewable tokens are renewed until they reach their max-ttl; otherwise the agent logs in again
 func (auth *vaultAuthImpl) Refresh(ctx context.Context, client *api.Client, force bool) error {
 	if !force && auth.expires.After(time.Now()) {
+		// new connections to other nodes must use the current token, too
+		if auth.token != "" {
+			client.SetToken(auth.token)
+		}
+		return nil
+	}
+
+	if !force && auth.renewable && auth.token != "" {
+		err := auth.renew(ctx, client)
+		if err == nil {
+			return nil
+		}
+		logging.Warn("Could not renew token, logging in again", "error", err)
+	}
+
+	return auth.login(ctx, client)
+}
+
+// Revoke revokes the token obtained by the last login
+func (auth *vaultAuthImpl) Revoke(ctx context.Context, client *api.Client) error {
+	if auth.token == "" || auth.static {
 		return nil
 	}
 
+	client.SetToken(auth.token)
+	err := auth.namespaced(client).Auth().Token().RevokeSelfWithContext(ctx, "")
+	client.ClearToken()
+
+	auth.token = ""
+	auth.renewable = false
+	auth.expires = time.Time{}
+
+	if err != nil {
+		return err
+	}
+
+	logging.Debug("Successfully revoked token")
+	return nil
+}
+
+func (auth *vaultAuthImpl) login(ctx context.Context, client *api.Client) error {
 	method, err := auth.factory.createAuthMethod()
 	if err != nil {
 		return err
 	}
 
-	logging.Debug("Logging into vault", "method", fmt.Sprintf("%T", method))
-	authSecret, err := client.Auth().Login(ctx, method)
+	login := auth.namespaced(client)
+
+	logging.Debug("Logging into vault", "method", fmt.Sprintf("%T", method), "namespace", auth.namespace)
+	authSecret, err := login.Auth().Login(ctx, method)
 	if err != nil {
 		return err
 	}
 
+	if login != client {
+		client.SetToken(login.Token())
+	}
+
 	tokenTTL, err := authSecret.TokenTTL()
 	if err != nil {
 		return err
@@ -70,7 +138,53 @@ func (auth *vaultAuthImpl) Refresh(ctx context.Context, client *api.Client, forc
 		return err
 	}
 
+	renewable, err := authSecret.TokenIsRenewable()
+	if err != nil {
+		return err
+	}
+
+	auth.token = client.Token()
+	auth.ttl = tokenTTL
+	auth.renewable = renewable
 	auth.expires = time.Now().Add(tokenTTL / 2)
-	logging.Debug("Successfully logged in ", "policies", tokenPolicies, "ttl", tokenTTL, "expires", auth.expires)
+	logging.Debug("Successfully logged in ", "policies", tokenPolicies, "ttl", tokenTTL, "renewable", renewable, "expires", auth.expires)
 	return nil
 }
+
+func (auth *vaultAuthImpl) renew(ctx context.Context, client *api.Client) error {
+	client.SetToken(auth.token)
+
+	logging.Debug("Renewing token", "namespace", auth.namespace)
+	authSecret, err := auth.namespaced(client).Auth().Token().RenewSelfWithContext(ctx, 0)
+	if err != nil {
+		return err
+	}
+
+	tokenTTL, err := authSecret.TokenTTL()
+	if err != nil {
+		return err
+	}
+
+	if tokenTTL <= 0 {
+		return fmt.Errorf("renewed token has no ttl")
+	}
+
+	// vault caps the ttl of renewals when the token approaches its max-ttl; log in again before it expires
+	if tokenTTL < auth.ttl {
+		logging.Debug("Token reached its max-ttl, logging in again on next refresh", "ttl", tokenTTL)
+		auth.renewable = false
+	}
+
+	auth.expires = time.Now().Add(tokenTTL / 2)
+	logging.Debug("Successfully renewed token", "ttl", tokenTTL, "expires", auth.expires)
+	return nil
+}
+
+// namespaced returns a copy of the client using the namespace of the auth-method.
+// Only authentication uses the namespace; the client's other requests like taking snapshots go to the root namespace
+func (auth *vaultAuthImpl) namespaced(client *api.Client) *api.Client {
+	if auth.namespace == "" {
+		return client
+	}
+	return client.WithNamespace(auth.namespace)
+}
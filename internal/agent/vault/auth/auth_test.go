@@ -3,9 +3,12 @@ package auth
 import (
 	"context"
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/test"
 	"github.com/hashicorp/vault/api"
 	"github.com/stretchr/testify/assert"
 )
@@ -99,6 +102,206 @@ func TestVaultAuth_Refresh_IgnoresExpiresIfForced(t *testing.T) {
 	assert.WithinRange(t, auth.expires, expectedExpires, expectedExpires.Add(50*time.Millisecond))
 }
 
+func TestVaultAuth_Refresh_LogsInToNamespace(t *testing.T) {
+	expectedSecret := &api.Secret{
+		Auth: &api.SecretAuth{
+			ClientToken:   "test-token",
+			LeaseDuration: 60,
+		},
+	}
+
+	var loginNamespace string
+	auth := vaultAuthImpl{
+		factory: authMethodFactoryStub{
+			method: authMethodStub{secret: expectedSecret, loginNamespace: &loginNamespace},
+		},
+		namespace: "test-ns",
+	}
+
+	client, err := api.NewClient(api.DefaultConfig())
+	assert.NoError(t, err, "NewClient failed unexpectedly")
+	client.ClearNamespace()
+
+	err = auth.Refresh(context.Background(), client, true)
+	assert.NoError(t, err, "Refresh failed unexpectedly")
+	assert.Equal(t, "test-ns", loginNamespace)
+	assert.Equal(t, "", client.Namespace())
+	assert.Equal(t, "test-token", client.Token())
+}
+
+func TestCreateVaultAuth_UsesDefaultNamespace(t *testing.T) {
+	config := VaultAuthConfig{AppRole: &AppRoleAuthConfig{}}
+	auth, err := CreateVaultAuth(config, "default-ns")
+	assert.NoError(t, err, "CreateVaultAuth failed unexpectedly")
+	assert.Equal(t, "default-ns", auth.(*vaultAuthImpl).namespace)
+
+	config.AppRole.Namespace = "approle-ns"
+	auth, err = CreateVaultAuth(config, "default-ns")
+	assert.NoError(t, err, "CreateVaultAuth failed unexpectedly")
+	assert.Equal(t, "approle-ns", auth.(*vaultAuthImpl).namespace)
+}
+
+func TestVaultAuth_Refresh_RenewsRenewableToken(t *testing.T) {
+	requests := map[string]string{}
+	client := newVaultServerStub(t, requests, `{"auth": {"client_token": "test-token", "lease_duration": 60, "renewable": true}}`)
+
+	auth := vaultAuthImpl{
+		factory: authMethodFactoryStub{
+			method: authMethodStub{loginError: errors.New("login failed")},
+		},
+		token:     "test-token",
+		ttl:       60 * time.Second,
+		renewable: true,
+	}
+
+	expectedExpires := time.Now().Add(30 * time.Second)
+	err := auth.Refresh(context.Background(), client, false)
+	assert.NoError(t, err, "Refresh failed unexpectedly")
+	assert.Equal(t, "test-token", requests["/v1/auth/token/renew-self"])
+	assert.True(t, auth.renewable)
+	assert.WithinRange(t, auth.expires, expectedExpires, expectedExpires.Add(50*time.Millisecond))
+}
+
+func TestVaultAuth_Refresh_LogsInIfRenewalFails(t *testing.T) {
+	requests := map[string]string{}
+	client := newVaultServerStub(t, requests, "")
+
+	auth := vaultAuthImpl{
+		factory: authMethodFactoryStub{
+			method: authMethodStub{secret: &api.Secret{Auth: &api.SecretAuth{ClientToken: "new-token", LeaseDuration: 60}}},
+		},
+		token:     "test-token",
+		ttl:       60 * time.Second,
+		renewable: true,
+	}
+
+	err := auth.Refresh(context.Background(), client, false)
+	assert.NoError(t, err, "Refresh failed unexpectedly")
+	assert.Equal(t, "test-token", requests["/v1/auth/token/renew-self"])
+	assert.Equal(t, "new-token", auth.token)
+	assert.Equal(t, "new-token", client.Token())
+	assert.False(t, auth.renewable)
+}
+
+func TestVaultAuth_Refresh_StopsRenewalAtMaxTTL(t *testing.T) {
+	requests := map[string]string{}
+	client := newVaultServerStub(t, requests, `{"auth": {"client_token": "test-token", "lease_duration": 10, "renewable": true}}`)
+
+	auth := vaultAuthImpl{
+		factory:   authMethodFactoryStub{},
+		token:     "test-token",
+		ttl:       60 * time.Second,
+		renewable: true,
+	}
+
+	expectedExpires := time.Now().Add(5 * time.Second)
+	err := auth.Refresh(context.Background(), client, false)
+	assert.NoError(t, err, "Refresh failed unexpectedly")
+	assert.False(t, auth.renewable)
+	assert.WithinRange(t, auth.expires, expectedExpires, expectedExpires.Add(50*time.Millisecond))
+}
+
+func TestVaultAuth_Refresh_UsesTokenForNewClients(t *testing.T) {
+	auth := vaultAuthImpl{
+		token:   "test-token",
+		expires: time.Now().Add(time.Minute),
+	}
+
+	client, err := api.NewClient(api.DefaultConfig())
+	assert.NoError(t, err, "NewClient failed unexpectedly")
+
+	err = auth.Refresh(context.Background(), client, false)
+	assert.NoError(t, err, "Refresh failed unexpectedly")
+	assert.Equal(t, "test-token", client.Token())
+}
+
+func TestVaultAuth_Revoke_RevokesToken(t *testing.T) {
+	requests := map[string]string{}
+	client := newVaultServerStub(t, requests, "{}")
+
+	auth := vaultAuthImpl{
+		token:     "test-token",
+		renewable: true,
+		expires:   time.Now().Add(time.Minute),
+	}
+
+	err := auth.Revoke(context.Background(), client)
+	assert.NoError(t, err, "Revoke failed unexpectedly")
+	assert.Equal(t, "test-token", requests["/v1/auth/token/revoke-self"])
+	assert.Empty(t, auth.token)
+	assert.Empty(t, client.Token())
+	assert.False(t, auth.renewable)
+	assert.Zero(t, auth.expires)
+}
+
+func TestVaultAuth_Revoke_KeepsConfiguredToken(t *testing.T) {
+	requests := map[string]string{}
+	client := newVaultServerStub(t, requests, "")
+
+	config := VaultAuthConfig{Token: test.PtrTo(Token("test-token"))}
+	vaultAuth, err := CreateVaultAuth(config, "")
+	assert.NoError(t, err, "CreateVaultAuth failed unexpectedly")
+
+	auth := vaultAuth.(*vaultAuthImpl)
+	auth.token = "test-token"
+
+	err = auth.Revoke(context.Background(), client)
+	assert.NoError(t, err, "Revoke failed unexpectedly")
+	assert.Empty(t, requests)
+	assert.Equal(t, "test-token", auth.token)
+}
+
+func TestVaultAuth_Refresh_RenewsConfiguredToken(t *testing.T) {
+	requests := map[string]string{}
+	client := newVaultServerStub(t, requests, `{"data": {"id": "test-token", "renewable": true, "ttl": 60}}`)
+
+	config := VaultAuthConfig{Token: test.PtrTo(Token("test-token"))}
+	vaultAuth, err := CreateVaultAuth(config, "")
+	assert.NoError(t, err, "CreateVaultAuth failed unexpectedly")
+
+	auth := vaultAuth.(*vaultAuthImpl)
+	err = auth.Refresh(context.Background(), client, true)
+	assert.NoError(t, err, "Refresh failed unexpectedly")
+	assert.Equal(t, map[string]string{"/v1/auth/token/lookup-self": "test-token"}, requests)
+	assert.Equal(t, 60*time.Second, auth.ttl)
+	assert.True(t, auth.renewable)
+
+	clear(requests)
+	auth.expires = time.Now().Add(-time.Second)
+
+	err = auth.Refresh(context.Background(), client, false)
+	assert.NoError(t, err, "Refresh failed unexpectedly")
+	assert.Equal(t, map[string]string{"/v1/auth/token/renew-self": "test-token"}, requests)
+
+	err = auth.Revoke(context.Background(), client)
+	assert.NoError(t, err, "Revoke failed unexpectedly")
+	assert.NotContains(t, requests, "/v1/auth/token/revoke-self")
+}
+
+// newVaultServerStub creates a client for a vault-server recording the token used for each request.
+// The server responds with the given response or with an error if the response is empty
+func newVaultServerStub(t *testing.T, requests map[string]string, response string) *api.Client {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path] = r.Header.Get("X-Vault-Token")
+		if response == "" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors": ["permission denied"]}`))
+			return
+		}
+		_, _ = w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	client, err := api.NewClient(config)
+	assert.NoError(t, err, "NewClient failed unexpectedly")
+	client.ClearToken()
+	return client
+}
+
 type authMethodFactoryStub struct {
 	method    api.AuthMethod
 	createErr error
@@ -112,11 +315,16 @@ func (stub authMethodFactoryStub) createAuthMethod() (api.AuthMethod, error) {
 }
 
 type authMethodStub struct {
-	loginError error
-	secret     *api.Secret
+	loginError     error
+	secret         *api.Secret
+	loginNamespace *string
 }
 
-func (stub authMethodStub) Login(_ context.Context, _ *api.Client) (*api.Secret, error) {
+func (stub authMethodStub) Login(_ context.Context, client *api.Client) (*api.Secret, error) {
+	if stub.loginNamespace != nil {
+		*stub.loginNamespace = client.Namespace()
+	}
+
 	if stub.loginError != nil {
 		return nil, stub.loginError
 	}
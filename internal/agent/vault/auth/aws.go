@@ -16,7 +16,8 @@ const (
 )
 
 type AWSAuthConfig struct {
-	Path              string        `default:"aws"`
+	Path              string `default:"aws"`
+	Namespace         string
 	Region            secret.Secret `default:"env://AWS_DEFAULT_REGION"`
 	EC2Nonce          secret.Secret
 	Role              string
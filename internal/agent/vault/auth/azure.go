@@ -6,9 +6,10 @@ import (
 )
 
 type AzureAuthConfig struct {
-	Path     string `default:"azure"`
-	Role     string `validate:"required"`
-	Resource string
+	Path      string `default:"azure"`
+	Namespace string
+	Role      string `validate:"required"`
+	Resource  string
 }
 
 func (config AzureAuthConfig) createAuthMethod() (api.AuthMethod, error) {
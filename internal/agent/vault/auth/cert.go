@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/config/secret"
+	"github.com/hashicorp/vault/api"
+)
+
+type CertAuthConfig struct {
+	Path       string `default:"cert"`
+	Namespace  string
+	Role       string        `validate:"required"`
+	ClientCert secret.Secret `validate:"required"`
+	ClientKey  secret.Secret `validate:"required"`
+}
+
+// certAuth logs in to vault's cert auth-method using a client-certificate
+// as there is no implementation of this method in vault's api
+type certAuth struct {
+	mountPath   string
+	role        string
+	certificate tls.Certificate
+}
+
+func (config CertAuthConfig) createAuthMethod() (api.AuthMethod, error) {
+	cert, err := config.ClientCert.Resolve(true)
+	if err != nil {
+		return nil, err
+	}
+	key, err := config.ClientKey.Resolve(true)
+	if err != nil {
+		return nil, err
+	}
+
+	certificate, err := tls.X509KeyPair([]byte(cert), []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("could not load client-certificate: %s", err)
+	}
+
+	return &certAuth{
+		mountPath:   config.Path,
+		role:        config.Role,
+		certificate: certificate,
+	}, nil
+}
+
+func (auth *certAuth) Login(ctx context.Context, client *api.Client) (*api.Secret, error) {
+	loginClient, err := auth.loginClient(client)
+	if err != nil {
+		return nil, err
+	}
+
+	return loginClient.Logical().WriteWithContext(
+		ctx,
+		fmt.Sprintf("auth/%s/login", auth.mountPath),
+		map[string]interface{}{"name": auth.role},
+	)
+}
+
+// loginClient creates a copy of the given client presenting the client-certificate in tls-handshakes
+func (auth *certAuth) loginClient(client *api.Client) (*api.Client, error) {
+	config := client.CloneConfig()
+
+	transport, ok := config.HttpClient.Transport.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("unsupported transport of vault-client: %T", config.HttpClient.Transport)
+	}
+
+	transport = transport.Clone()
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	transport.TLSClientConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		return &auth.certificate, nil
+	}
+	config.HttpClient.Transport = transport
+
+	loginClient, err := api.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	loginClient.ClearToken()
+	loginClient.ClearNamespace()
+	if namespace := client.Namespace(); namespace != "" {
+		loginClient.SetNamespace(namespace)
+	}
+	return loginClient, nil
+}
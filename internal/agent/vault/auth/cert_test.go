@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/config/secret"
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/test"
+	"github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateCertAuth(t *testing.T) {
+	certFile, keyFile := test.WriteCertificate(t, t.TempDir(), "client")
+	config := CertAuthConfig{
+		Role:       "test-role",
+		ClientCert: secret.FromFile(certFile),
+		ClientKey:  secret.FromFile(keyFile),
+		Path:       "test-path",
+	}
+
+	expectedCertificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	assert.NoError(t, err, "LoadX509KeyPair failed unexpectedly")
+
+	method, err := config.createAuthMethod()
+	assert.NoError(t, err, "createAuthMethod failed unexpectedly")
+
+	assert.Equal(t, &certAuth{mountPath: "test-path", role: "test-role", certificate: expectedCertificate}, method)
+}
+
+func TestCreateCertAuthFailsForInvalidCertificate(t *testing.T) {
+	config := CertAuthConfig{
+		Role:       "test-role",
+		ClientCert: secret.FromString("invalid"),
+		ClientKey:  secret.FromString("invalid"),
+	}
+
+	_, err := config.createAuthMethod()
+	assert.Error(t, err, "createAuthMethod should fail for invalid certificate")
+}
+
+func TestCertAuthLogsInWithClientCertificate(t *testing.T) {
+	certFile, keyFile := test.WriteCertificate(t, t.TempDir(), "client")
+	config := CertAuthConfig{
+		Role:       "test-role",
+		ClientCert: secret.FromFile(certFile),
+		ClientKey:  secret.FromFile(keyFile),
+		Path:       "test-path",
+	}
+
+	var loginPath, loginRole, loginNamespace, loginCertificate string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]string{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		loginPath = r.URL.Path
+		loginRole = body["name"]
+		loginNamespace = r.Header.Get("X-Vault-Namespace")
+		if len(r.TLS.PeerCertificates) > 0 {
+			loginCertificate = r.TLS.PeerCertificates[0].Subject.CommonName
+		}
+
+		_, _ = w.Write([]byte(`{"auth": {"client_token": "test-token", "lease_duration": 60}}`))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	apiConfig := api.DefaultConfig()
+	apiConfig.Address = server.URL
+	assert.NoError(t, apiConfig.ConfigureTLS(&api.TLSConfig{Insecure: true}))
+	client, err := api.NewClient(apiConfig)
+	assert.NoError(t, err, "NewClient failed unexpectedly")
+	client.SetNamespace("test-ns")
+
+	method, err := config.createAuthMethod()
+	assert.NoError(t, err, "createAuthMethod failed unexpectedly")
+
+	authSecret, err := client.Auth().Login(context.Background(), method)
+	assert.NoError(t, err, "Login failed unexpectedly")
+
+	assert.Equal(t, "test-token", authSecret.Auth.ClientToken)
+	assert.Equal(t, "test-token", client.Token())
+	assert.Equal(t, "/v1/auth/test-path/login", loginPath)
+	assert.Equal(t, "test-role", loginRole)
+	assert.Equal(t, "test-ns", loginNamespace)
+	assert.Equal(t, "client", loginCertificate)
+}
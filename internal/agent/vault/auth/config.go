@@ -5,7 +5,9 @@ type VaultAuthConfig struct {
 	AppRole    *AppRoleAuthConfig
 	AWS        *AWSAuthConfig
 	Azure      *AzureAuthConfig
+	Cert       *CertAuthConfig
 	GCP        *GCPAuthConfig
+	JWT        *JWTAuthConfig
 	Kubernetes *KubernetesAuthConfig
 	LDAP       *LDAPAuthConfig
 	UserPass   *UserPassAuthConfig
@@ -7,6 +7,7 @@ import (
 
 type GCPAuthConfig struct {
 	Path                string `default:"gcp"`
+	Namespace           string
 	Role                string `validate:"required"`
 	ServiceAccountEmail string
 }
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/config/secret"
+	"github.com/hashicorp/vault/api"
+)
+
+type JWTAuthConfig struct {
+	Path      string `default:"jwt"`
+	Namespace string
+	Role      string        `validate:"required"`
+	Token     secret.Secret `validate:"required"`
+}
+
+// jwtAuth logs in to vault's jwt auth-method using a signed token
+// as there is no implementation of this method in vault's api
+type jwtAuth struct {
+	mountPath string
+	role      string
+	token     string
+}
+
+// createAuthMethod is called on every login so that rotated tokens are picked up;
+// as renewable vault-tokens are renewed instead of logging in again, this happens when they reach their max-ttl
+func (config JWTAuthConfig) createAuthMethod() (api.AuthMethod, error) {
+	token, err := config.Token.Resolve(true)
+	if err != nil {
+		return nil, err
+	}
+	// token-files like those of kubernetes' projected volumes usually end with a newline
+	token = strings.TrimSpace(token)
+
+	return &jwtAuth{
+		mountPath: config.Path,
+		role:      config.Role,
+		token:     token,
+	}, nil
+}
+
+func (auth *jwtAuth) Login(ctx context.Context, client *api.Client) (*api.Secret, error) {
+	return client.Logical().WriteWithContext(
+		ctx,
+		fmt.Sprintf("auth/%s/login", auth.mountPath),
+		map[string]interface{}{"role": auth.role, "jwt": auth.token},
+	)
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/config/secret"
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/test"
+	"github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateJWTAuth(t *testing.T) {
+	jwtPath := fmt.Sprintf("%s/jwt", t.TempDir())
+	config := JWTAuthConfig{
+		Role:  "test-role",
+		Token: secret.FromFile(jwtPath),
+		Path:  "test-path",
+	}
+
+	err := test.WriteFile(t, jwtPath, "test")
+	assert.NoError(t, err, "could not write jwt-file")
+
+	authMethod, err := config.createAuthMethod()
+	assert.NoError(t, err, "createAuthMethod failed unexpectedly")
+	assert.Equal(t, &jwtAuth{mountPath: "test-path", role: "test-role", token: "test"}, authMethod)
+
+	err = test.WriteFile(t, jwtPath, "rotated\n")
+	assert.NoError(t, err, "could not write jwt-file")
+
+	authMethod, err = config.createAuthMethod()
+	assert.NoError(t, err, "createAuthMethod failed unexpectedly")
+	assert.Equal(t, &jwtAuth{mountPath: "test-path", role: "test-role", token: "rotated"}, authMethod)
+}
+
+func TestCreateJWTAuthFailsForMissingToken(t *testing.T) {
+	config := JWTAuthConfig{
+		Role:  "test-role",
+		Token: secret.FromFile(fmt.Sprintf("%s/missing", t.TempDir())),
+	}
+
+	_, err := config.createAuthMethod()
+	assert.Error(t, err, "createAuthMethod should fail if token can not be read")
+}
+
+func TestJWTAuthLogsInWithToken(t *testing.T) {
+	var loginPath string
+	var loginBody map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		loginPath = r.URL.Path
+		_ = json.NewDecoder(r.Body).Decode(&loginBody)
+		_, _ = w.Write([]byte(`{"auth": {"client_token": "test-token", "lease_duration": 60}}`))
+	}))
+	defer server.Close()
+
+	apiConfig := api.DefaultConfig()
+	apiConfig.Address = server.URL
+	client, err := api.NewClient(apiConfig)
+	assert.NoError(t, err, "NewClient failed unexpectedly")
+
+	authSecret, err := client.Auth().Login(context.Background(), &jwtAuth{mountPath: "test-path", role: "test-role", token: "test-jwt"})
+	assert.NoError(t, err, "Login failed unexpectedly")
+
+	assert.Equal(t, "test-token", authSecret.Auth.ClientToken)
+	assert.Equal(t, "/v1/auth/test-path/login", loginPath)
+	assert.Equal(t, map[string]string{"role": "test-role", "jwt": "test-jwt"}, loginBody)
+}
@@ -7,9 +7,10 @@ import (
 )
 
 type KubernetesAuthConfig struct {
-	Path     string        `default:"kubernetes"`
-	Role     string        `validate:"required"`
-	JWTToken secret.Secret `default:"file:///var/run/secrets/kubernetes.io/serviceaccount/token" validate:"required"`
+	Path      string `default:"kubernetes"`
+	Namespace string
+	Role      string        `validate:"required"`
+	JWTToken  secret.Secret `default:"file:///var/run/secrets/kubernetes.io/serviceaccount/token" validate:"required"`
 }
 
 func (config KubernetesAuthConfig) createAuthMethod() (api.AuthMethod, error) {
@@ -7,9 +7,10 @@ import (
 )
 
 type LDAPAuthConfig struct {
-	Path     string        `default:"ldap"`
-	Username secret.Secret `validate:"required"`
-	Password secret.Secret `validate:"required"`
+	Path      string `default:"ldap"`
+	Namespace string
+	Username  secret.Secret `validate:"required"`
+	Password  secret.Secret `validate:"required"`
 }
 
 func (config LDAPAuthConfig) createAuthMethod() (api.AuthMethod, error) {
@@ -41,8 +41,25 @@ func (auth tokenAuth) login(ctx context.Context, client *api.Client, lookup toke
 	}
 
 	if authSecret.Auth == nil {
+		// lookup-self reports the token's ttl and renewability in its data; tokens without ttl are looked up again daily
+		ttl, err := authSecret.TokenTTL()
+		if err != nil {
+			client.ClearToken()
+			return nil, err
+		}
+		if ttl <= 0 {
+			ttl = 24 * time.Hour
+		}
+
+		renewable, err := authSecret.TokenIsRenewable()
+		if err != nil {
+			client.ClearToken()
+			return nil, err
+		}
+
 		authSecret.Auth = &api.SecretAuth{
-			LeaseDuration: int(24 * time.Hour.Seconds()),
+			LeaseDuration: int(ttl.Seconds()),
+			Renewable:     renewable,
 			ClientToken:   auth.token,
 		}
 	}
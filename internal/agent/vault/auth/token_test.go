@@ -7,6 +7,7 @@ import (
 	"github.com/hashicorp/vault/api"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestCreateAuthMethod(t *testing.T) {
@@ -48,6 +49,29 @@ func TestTokenAuthReturnsExpirationBasedOnLoginLeaseDuration(t *testing.T) {
 	assert.Equal(t, auth.token, client.Token())
 }
 
+func TestTokenAuthUsesTTLAndRenewabilityOfLookup(t *testing.T) {
+	client := &api.Client{}
+	lookup := vaultLookupSecretStub{&api.Secret{Data: map[string]interface{}{"ttl": 60, "renewable": true}}}
+
+	authSecret, err := tokenAuth{"test"}.login(context.Background(), client, lookup)
+	assert.NoError(t, err, "token-VaultAuth failed unexpectedly")
+	assert.Equal(t, &api.SecretAuth{LeaseDuration: 60, Renewable: true, ClientToken: "test"}, authSecret.Auth)
+
+	lookup = vaultLookupSecretStub{&api.Secret{Data: map[string]interface{}{"ttl": 0, "renewable": false}}}
+
+	authSecret, err = tokenAuth{"test"}.login(context.Background(), client, lookup)
+	assert.NoError(t, err, "token-VaultAuth failed unexpectedly")
+	assert.Equal(t, &api.SecretAuth{LeaseDuration: int(24 * time.Hour.Seconds()), ClientToken: "test"}, authSecret.Auth)
+}
+
+type vaultLookupSecretStub struct {
+	secret *api.Secret
+}
+
+func (stub vaultLookupSecretStub) Lookup(context.Context, *api.Client) (*api.Secret, error) {
+	return stub.secret, nil
+}
+
 type tokenLookupStub struct {
 	lookupFails   bool
 	leaseDuration int
@@ -7,9 +7,10 @@ import (
 )
 
 type UserPassAuthConfig struct {
-	Path     string        `default:"userpass"`
-	Username secret.Secret `validate:"required"`
-	Password secret.Secret `validate:"required"`
+	Path      string `default:"userpass"`
+	Namespace string
+	Username  secret.Secret `validate:"required"`
+	Password  secret.Secret `validate:"required"`
 }
 
 func (config UserPassAuthConfig) createAuthMethod() (api.AuthMethod, error) {
@@ -28,11 +28,14 @@ type vaultAPI interface {
 	Connect(string) (*api.Client, error)
 	GetLeader(context.Context, *api.Client) (bool, string)
 	TakeSnapshot(context.Context, *api.Client, io.Writer) error
+	RestoreSnapshot(context.Context, *api.Client, io.Reader, bool) error
+	GetVersion(context.Context, *api.Client) (string, error)
 }
 
 // internal implementation of the vault-api
 type vaultAPIImpl struct {
 	config *api.Config
+	tls    *tlsReloader
 }
 
 // CreateClient creates a VaultClient using an api-implementation delegating to a real vault-api-client
@@ -43,12 +46,12 @@ func CreateClient(config VaultClientConfig) (*VaultClient, error) {
 		nodes = append(nodes, node)
 	}
 
-	auth, err := auth.CreateVaultAuth(config.Auth)
+	auth, err := auth.CreateVaultAuth(config.Auth, config.Namespace)
 	if err != nil {
 		return nil, err
 	}
 
-	api, err := newVaultAPIImpl(config.Insecure, config.Timeout)
+	api, err := newVaultAPIImpl(config.TLS, config.Insecure, config.Timeout)
 	if err != nil {
 		return nil, err
 	}
@@ -75,6 +78,61 @@ func (c *VaultClient) TakeSnapshot(ctx context.Context, writer io.Writer) error
 	return c.api.TakeSnapshot(ctx, c.connection, writer)
 }
 
+// RestoreSnapshot restores the given snapshot on the leader-node.
+// If force is true, the snapshot is restored even if its keys do not match those of the cluster
+func (c *VaultClient) RestoreSnapshot(ctx context.Context, reader io.Reader, force bool) error {
+	if err := c.ensureLeader(ctx); err != nil {
+		return fmt.Errorf("could not (re-)connect to leader: %v", err)
+	}
+
+	return c.api.RestoreSnapshot(ctx, c.connection, reader, force)
+}
+
+// ConnectToLeader authenticates with and connects to the leader-node of the cluster
+// and returns the address of the leader-node
+func (c *VaultClient) ConnectToLeader(ctx context.Context) (string, error) {
+	if err := c.ensureLeader(ctx); err != nil {
+		return "", fmt.Errorf("could not (re-)connect to leader: %v", err)
+	}
+
+	return c.connection.Address(), nil
+}
+
+// Close revokes the token obtained when logging in to vault and closes the connection
+func (c *VaultClient) Close(ctx context.Context) error {
+	if c.connection == nil {
+		return nil
+	}
+
+	err := c.auth.Revoke(ctx, c.connection)
+	c.connection = nil
+	return err
+}
+
+// ConnectedNode returns the address of the node the client is currently connected to
+// or an empty string if it is not connected
+func (c *VaultClient) ConnectedNode() string {
+	if c.connection == nil {
+		return ""
+	}
+	return c.connection.Address()
+}
+
+// VaultVersion returns the version of vault running on the node the client is currently connected to
+// or an empty string if it is not connected or the version could not be determined
+func (c *VaultClient) VaultVersion(ctx context.Context) string {
+	if c.connection == nil {
+		return ""
+	}
+
+	version, err := c.api.GetVersion(ctx, c.connection)
+	if err != nil {
+		logging.Warn("could not determine version of vault", "node", c.connection.Address(), "error", err)
+		return ""
+	}
+	return version
+}
+
 func (c *VaultClient) ensureLeader(ctx context.Context) error {
 	leader, detectedLeader := c.isConnectedToLeader(ctx, c.connection)
 	if leader {
@@ -157,31 +215,57 @@ func (c *VaultClient) selectNodesToConnect(nodes []string, detectedLeader string
 }
 
 // creates a api-implementation using a real vault-api-client
-func newVaultAPIImpl(insecure bool, timeout time.Duration) (vaultAPIImpl, error) {
-	tlsConfig := &api.TLSConfig{
-		Insecure: insecure,
+func newVaultAPIImpl(tlsConfig VaultTLSConfig, insecure bool, timeout time.Duration) (vaultAPIImpl, error) {
+	reloader, err := newTLSReloader(tlsConfig, insecure)
+	if err != nil {
+		return vaultAPIImpl{}, err
 	}
 
 	apiConfig := api.DefaultConfig()
 	apiConfig.HttpClient.Timeout = timeout
 
-	if err := apiConfig.ConfigureTLS(tlsConfig); err != nil {
+	if err := reloader.configure(apiConfig); err != nil {
 		return vaultAPIImpl{}, err
 	}
 
-	return vaultAPIImpl{apiConfig}, nil
+	return vaultAPIImpl{apiConfig, reloader}, nil
 }
 
 func (impl vaultAPIImpl) Connect(url string) (*api.Client, error) {
+	impl.reloadTLS()
+
 	impl.config.Address = url
-	return api.NewClient(impl.config)
+	client, err := api.NewClient(impl.config)
+	if err != nil {
+		return nil, err
+	}
+
+	// raft-snapshots can only be taken in the root namespace; namespaces are only used to log in
+	client.ClearNamespace()
+	return client, nil
 }
 
 func (impl vaultAPIImpl) TakeSnapshot(ctx context.Context, client *api.Client, writer io.Writer) error {
 	return client.Sys().RaftSnapshotWithContext(ctx, writer)
 }
 
+func (impl vaultAPIImpl) RestoreSnapshot(ctx context.Context, client *api.Client, reader io.Reader, force bool) error {
+	return client.Sys().RaftSnapshotRestoreWithContext(ctx, reader, force)
+}
+
+// GetVersion returns the version of vault reported by the unauthenticated seal-status of the node
+func (impl vaultAPIImpl) GetVersion(ctx context.Context, client *api.Client) (string, error) {
+	status, err := client.Sys().SealStatusWithContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	return status.Version, nil
+}
+
 func (impl vaultAPIImpl) GetLeader(ctx context.Context, client *api.Client) (bool, string) {
+	// the leader is checked before each snapshot, so changed tls-files are picked up by existing connections, too
+	impl.reloadTLS()
+
 	leader, err := client.Sys().LeaderWithContext(ctx)
 	if err != nil {
 		logging.Warn("could not determine leader-state of node", "node", client.Address())
@@ -190,3 +274,12 @@ func (impl vaultAPIImpl) GetLeader(ctx context.Context, client *api.Client) (boo
 
 	return leader.IsSelf, leader.LeaderAddress
 }
+
+func (impl vaultAPIImpl) reloadTLS() {
+	reloaded, err := impl.tls.reload(impl.config)
+	if err != nil {
+		logging.Warn("could not reload tls-configuration", "err", err)
+	} else if reloaded {
+		logging.Info("reloaded tls-configuration")
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"slices"
 	"testing"
 	"time"
@@ -329,6 +331,90 @@ func TestClientTakesSnapshot(t *testing.T) {
 	assert.Same(t, writer, apiStub.snapshotWriter)
 }
 
+func TestClientCloseRevokesToken(t *testing.T) {
+	node1 := "http://node1"
+
+	auth := &authMethodStub{}
+	client := NewClient(&vaultAPIStub{}, []string{node1}, false, auth)
+
+	assert.NoError(t, client.Close(context.Background()), "Close() failed unexpectedly")
+	assert.Nil(t, auth.revoked)
+
+	connectionConfig := api.DefaultConfig()
+	connectionConfig.Address = node1
+	connection, _ := api.NewClient(connectionConfig)
+	client.connection = connection
+
+	assert.NoError(t, client.Close(context.Background()), "Close() failed unexpectedly")
+	assert.Same(t, connection, auth.revoked)
+	assert.Nil(t, client.connection)
+	assert.Equal(t, "", client.ConnectedNode())
+}
+
+func TestClientRestoresSnapshotOnLeader(t *testing.T) {
+	node1 := "http://node1"
+	node2 := "http://node2"
+
+	auth := &authMethodStub{}
+	apiStub := &vaultAPIStub{
+		Nodes: map[string]bool{
+			node1: false,
+			node2: true,
+		},
+	}
+
+	client := NewClient(apiStub, []string{node1, node2}, false, auth)
+
+	ctx := context.Background()
+	reader := bytes.NewReader([]byte("test"))
+	err := client.RestoreSnapshot(ctx, reader, true)
+
+	assert.NoError(t, err, "RestoreSnapshot() failed unexpectedly")
+	assert.Equal(t, node2, client.connection.Address())
+	assert.Equal(t, ctx, apiStub.snapshotContext)
+	assert.Same(t, client.connection, apiStub.snapshotConnection)
+	assert.Same(t, reader, apiStub.restoredReader)
+	assert.True(t, apiStub.restoreForced)
+}
+
+func TestClientConnectToLeaderReturnsLeaderAddress(t *testing.T) {
+	node1 := "http://node1"
+	node2 := "http://node2"
+
+	auth := &authMethodStub{}
+	apiStub := &vaultAPIStub{
+		Nodes: map[string]bool{
+			node1: false,
+			node2: true,
+		},
+	}
+
+	client := NewClient(apiStub, []string{node1, node2}, true, auth)
+
+	leader, err := client.ConnectToLeader(context.Background())
+
+	assert.NoError(t, err, "ConnectToLeader() failed unexpectedly")
+	assert.Equal(t, node2, leader)
+	assert.Equal(t, []string{node1, node2}, auth.Connections)
+}
+
+func TestClientConnectToLeaderFailsIfAuthFails(t *testing.T) {
+	node1 := "http://node1"
+
+	auth := &authMethodStub{FailingNodes: []string{node1}}
+	apiStub := &vaultAPIStub{
+		Nodes: map[string]bool{
+			node1: true,
+		},
+	}
+
+	client := NewClient(apiStub, []string{node1}, false, auth)
+
+	_, err := client.ConnectToLeader(context.Background())
+
+	assert.Error(t, err, "ConnectToLeader() should fail if authentication fails")
+}
+
 func TestCreateClient(t *testing.T) {
 	node1 := "http://node1"
 	node2 := "http://node2"
@@ -345,18 +431,71 @@ func TestCreateClient(t *testing.T) {
 				Password: secret.FromString("test"),
 			},
 		},
-		Insecure: true,
-		Timeout:  time.Duration(60) * time.Second,
+		Insecure:  true,
+		Timeout:   time.Duration(60) * time.Second,
+		Namespace: "test-ns",
 	}
 
 	client, _ := CreateClient(config)
 	assert.Equal(t, []string{node1, node2, node3}, client.nodes)
 	assert.True(t, client.autoDetectLeader)
 	assert.NotEmpty(t, client.auth)
-	assert.True(t, client.api.(vaultAPIImpl).config.TLSConfig().InsecureSkipVerify)
+	assert.True(t, transportTLSConfig(t, client.api.(vaultAPIImpl)).InsecureSkipVerify)
 	assert.Equal(t, config.Timeout, client.api.(vaultAPIImpl).config.Timeout)
 }
 
+func TestVaultAPIConnectsToRootNamespace(t *testing.T) {
+	t.Setenv(api.EnvVaultNamespace, "test-ns")
+
+	impl, err := newVaultAPIImpl(VaultTLSConfig{}, false, time.Minute)
+	assert.NoError(t, err, "newVaultAPIImpl failed unexpectedly")
+
+	client, err := impl.Connect("http://node1")
+	assert.NoError(t, err, "Connect failed unexpectedly")
+	assert.Equal(t, "", client.Namespace())
+}
+
+func TestClientReturnsVaultVersionOfConnectedNode(t *testing.T) {
+	node1 := "http://node1"
+
+	apiStub := &vaultAPIStub{
+		Nodes: map[string]bool{
+			node1: true,
+		},
+		version: "1.17.2",
+	}
+
+	client := NewClient(apiStub, []string{node1}, false, &authMethodStub{})
+	assert.Equal(t, "", client.VaultVersion(context.Background()), "VaultVersion() should be empty if not connected")
+
+	_, err := client.ConnectToLeader(context.Background())
+	assert.NoError(t, err, "ConnectToLeader() failed unexpectedly")
+	assert.Equal(t, "1.17.2", client.VaultVersion(context.Background()))
+
+	apiStub.versionFails = true
+	assert.Equal(t, "", client.VaultVersion(context.Background()), "VaultVersion() should be empty if version can not be determined")
+}
+
+func TestVaultAPIGetsVersionFromSealStatus(t *testing.T) {
+	var requestPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestPath = r.URL.Path
+		_, _ = w.Write([]byte(`{"type": "shamir", "sealed": false, "version": "1.17.2"}`))
+	}))
+	defer server.Close()
+
+	impl, err := newVaultAPIImpl(VaultTLSConfig{}, false, time.Minute)
+	assert.NoError(t, err, "newVaultAPIImpl failed unexpectedly")
+
+	client, err := impl.Connect(server.URL)
+	assert.NoError(t, err, "Connect failed unexpectedly")
+
+	version, err := impl.GetVersion(context.Background(), client)
+	assert.NoError(t, err, "GetVersion failed unexpectedly")
+	assert.Equal(t, "1.17.2", version)
+	assert.Equal(t, "/v1/sys/seal-status", requestPath)
+}
+
 type vaultAPIStub struct {
 	Nodes              map[string]bool
 	FailingNodes       []string
@@ -365,6 +504,10 @@ type vaultAPIStub struct {
 	snapshotContext    context.Context
 	snapshotConnection *api.Client
 	snapshotWriter     io.Writer
+	restoredReader     io.Reader
+	restoreForced      bool
+	version            string
+	versionFails       bool
 }
 
 func (stub *vaultAPIStub) Connect(node string) (*api.Client, error) {
@@ -406,9 +549,25 @@ func (stub *vaultAPIStub) TakeSnapshot(ctx context.Context, conn *api.Client, wr
 	return nil
 }
 
+func (stub *vaultAPIStub) RestoreSnapshot(ctx context.Context, conn *api.Client, reader io.Reader, force bool) error {
+	stub.snapshotContext = ctx
+	stub.snapshotConnection = conn
+	stub.restoredReader = reader
+	stub.restoreForced = force
+	return nil
+}
+
+func (stub *vaultAPIStub) GetVersion(context.Context, *api.Client) (string, error) {
+	if stub.versionFails {
+		return "", errors.New("could not get version")
+	}
+	return stub.version, nil
+}
+
 type authMethodStub struct {
 	Connections  []string
 	FailingNodes []string
+	revoked      *api.Client
 }
 
 func (a *authMethodStub) Refresh(_ context.Context, client *api.Client, _ bool) error {
@@ -418,3 +577,8 @@ func (a *authMethodStub) Refresh(_ context.Context, client *api.Client, _ bool)
 	}
 	return nil
 }
+
+func (a *authMethodStub) Revoke(_ context.Context, client *api.Client) error {
+	a.revoked = client
+	return nil
+}
@@ -7,10 +7,12 @@ import (
 )
 
 type VaultClientConfig struct {
-	Nodes    VaultNodesConfig `validate:"required"`
-	Timeout  time.Duration    `default:"60s"`
-	Insecure bool
-	Auth     auth.VaultAuthConfig
+	Nodes     VaultNodesConfig `validate:"required"`
+	Timeout   time.Duration    `default:"60s"`
+	Insecure  bool
+	TLS       VaultTLSConfig
+	Namespace string
+	Auth      auth.VaultAuthConfig
 }
 
 type VaultNodesConfig struct {
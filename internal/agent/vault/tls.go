@@ -0,0 +1,149 @@
+package vault
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/config/secret"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// VaultTLSConfig configures the tls-connections to the vault-nodes.
+// CACert, ClientCert and ClientKey must reference files (file://<path>) which are reloaded when they change
+type VaultTLSConfig struct {
+	CACert     secret.Secret
+	CAPath     string
+	ClientCert secret.Secret
+	ClientKey  secret.Secret
+	ServerName string
+	MinVersion string `default:"1.2" validate:"oneof=1.0 1.1 1.2 1.3"`
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsReloader configures the tls-settings of the vault-api and reconfigures them when the configured files change
+type tlsReloader struct {
+	config     *api.TLSConfig
+	minVersion uint16
+	state      string
+}
+
+func newTLSReloader(config VaultTLSConfig, insecure bool) (*tlsReloader, error) {
+	caCert, err := tlsFilePath("caCert", config.CACert)
+	if err != nil {
+		return nil, err
+	}
+
+	clientCert, err := tlsFilePath("clientCert", config.ClientCert)
+	if err != nil {
+		return nil, err
+	}
+
+	clientKey, err := tlsFilePath("clientKey", config.ClientKey)
+	if err != nil {
+		return nil, err
+	}
+
+	minVersion, ok := tlsVersions[config.MinVersion]
+	if !ok {
+		minVersion = tls.VersionTLS12
+	}
+
+	return &tlsReloader{
+		config: &api.TLSConfig{
+			CACert:        caCert,
+			CAPath:        config.CAPath,
+			ClientCert:    clientCert,
+			ClientKey:     clientKey,
+			TLSServerName: config.ServerName,
+			Insecure:      insecure,
+		},
+		minVersion: minVersion,
+	}, nil
+}
+
+func tlsFilePath(name string, s secret.Secret) (string, error) {
+	if s.IsZero() {
+		return "", nil
+	}
+
+	path, ok := s.FilePath()
+	if !ok {
+		return "", fmt.Errorf("tls.%s must reference a file", name)
+	}
+	return path, nil
+}
+
+// configure applies the tls-settings to the given vault-api-configuration.
+// The settings are applied to a new transport replacing the transport of the configuration,
+// as the tls-configuration of a transport must not be modified while requests are in flight
+func (r *tlsReloader) configure(config *api.Config) error {
+	state := r.fingerprint()
+
+	previous, ok := config.HttpClient.Transport.(*http.Transport)
+	if !ok {
+		return fmt.Errorf("unsupported transport of vault-api: %T", config.HttpClient.Transport)
+	}
+
+	tlsConfig := api.DefaultConfig()
+	if tlsConfig.Error != nil {
+		return tlsConfig.Error
+	}
+	if err := tlsConfig.ConfigureTLS(r.config); err != nil {
+		return err
+	}
+
+	transport := tlsConfig.HttpClient.Transport.(*http.Transport)
+	transport.TLSClientConfig.MinVersion = r.minVersion
+
+	config.HttpClient.Transport = transport
+	// connections of the previous transport are closed when they become idle
+	previous.CloseIdleConnections()
+
+	r.state = state
+	return nil
+}
+
+// reload reconfigures the tls-settings of the given vault-api-configuration if the configured files changed
+func (r *tlsReloader) reload(config *api.Config) (bool, error) {
+	if r.fingerprint() == r.state {
+		return false, nil
+	}
+
+	return true, r.configure(config)
+}
+
+// fingerprint identifies the current state of the configured files by their modification-times and sizes
+func (r *tlsReloader) fingerprint() string {
+	files := []string{r.config.CACert, r.config.ClientCert, r.config.ClientKey}
+	if r.config.CAPath != "" {
+		if entries, err := os.ReadDir(r.config.CAPath); err == nil {
+			for _, entry := range entries {
+				files = append(files, filepath.Join(r.config.CAPath, entry.Name()))
+			}
+		}
+	}
+
+	fingerprint := strings.Builder{}
+	for _, file := range files {
+		if file == "" {
+			continue
+		}
+
+		// use stat instead of lstat to follow symlinks as used e.g. by kubernetes to update mounted secrets
+		if info, err := os.Stat(file); err == nil {
+			fingerprint.WriteString(fmt.Sprintf("%s:%d:%d;", file, info.ModTime().UnixNano(), info.Size()))
+		}
+	}
+	return fingerprint.String()
+}
@@ -0,0 +1,132 @@
+package vault
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/config/secret"
+	"github.com/Argelbargel/vault-raft-snapshot-agent/internal/agent/test"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVaultAPIConfiguresTLS(t *testing.T) {
+	dir := t.TempDir()
+	caCert, _ := test.WriteCertificate(t, dir, "ca")
+	clientCert, clientKey := test.WriteCertificate(t, dir, "client")
+
+	impl, err := newVaultAPIImpl(
+		VaultTLSConfig{
+			CACert:     secret.FromFile(caCert),
+			ClientCert: secret.FromFile(clientCert),
+			ClientKey:  secret.FromFile(clientKey),
+			ServerName: "vault.example.com",
+			MinVersion: "1.3",
+		},
+		false,
+		time.Minute,
+	)
+	assert.NoError(t, err, "newVaultAPIImpl failed unexpectedly")
+
+	tlsConfig := transportTLSConfig(t, impl)
+	assert.Equal(t, "vault.example.com", tlsConfig.ServerName)
+	assert.Equal(t, uint16(tls.VersionTLS13), tlsConfig.MinVersion)
+	assert.False(t, tlsConfig.InsecureSkipVerify)
+	assert.NotNil(t, tlsConfig.RootCAs)
+	assertClientCertificate(t, impl, clientCert)
+}
+
+func TestVaultAPIFailsForTLSSecretsNotReferencingFiles(t *testing.T) {
+	_, err := newVaultAPIImpl(VaultTLSConfig{CACert: secret.FromString("-----BEGIN CERTIFICATE-----")}, false, time.Minute)
+	assert.Error(t, err, "newVaultAPIImpl should fail if caCert does not reference a file")
+
+	_, err = newVaultAPIImpl(VaultTLSConfig{ClientCert: secret.FromEnv("TEST"), ClientKey: secret.FromEnv("TEST")}, false, time.Minute)
+	assert.Error(t, err, "newVaultAPIImpl should fail if clientCert does not reference a file")
+}
+
+func TestVaultAPIFailsForMissingClientKey(t *testing.T) {
+	dir := t.TempDir()
+	clientCert, _ := test.WriteCertificate(t, dir, "client")
+
+	_, err := newVaultAPIImpl(VaultTLSConfig{ClientCert: secret.FromFile(clientCert)}, false, time.Minute)
+	assert.Error(t, err, "newVaultAPIImpl should fail if clientKey is missing")
+}
+
+func TestVaultAPIReloadsChangedTLSFiles(t *testing.T) {
+	dir := t.TempDir()
+	clientCert, clientKey := test.WriteCertificate(t, dir, "client")
+
+	impl, err := newVaultAPIImpl(
+		VaultTLSConfig{ClientCert: secret.FromFile(clientCert), ClientKey: secret.FromFile(clientKey)},
+		false,
+		time.Minute,
+	)
+	assert.NoError(t, err, "newVaultAPIImpl failed unexpectedly")
+
+	reloaded, err := impl.tls.reload(impl.config)
+	assert.NoError(t, err, "reload failed unexpectedly")
+	assert.False(t, reloaded)
+
+	previous := transportTLSConfig(t, impl)
+	previousCert, err := previous.GetClientCertificate(&tls.CertificateRequestInfo{})
+	assert.NoError(t, err, "GetClientCertificate failed unexpectedly")
+
+	test.WriteCertificate(t, dir, "client")
+	modified := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(clientCert, modified, modified))
+	assert.NoError(t, os.Chtimes(clientKey, modified, modified))
+
+	reloaded, err = impl.tls.reload(impl.config)
+	assert.NoError(t, err, "reload failed unexpectedly")
+	assert.True(t, reloaded)
+	assertClientCertificate(t, impl, clientCert)
+
+	// the tls-configuration in use must not be modified by reloading
+	assert.NotSame(t, previous, transportTLSConfig(t, impl))
+	unmodifiedCert, err := previous.GetClientCertificate(&tls.CertificateRequestInfo{})
+	assert.NoError(t, err, "GetClientCertificate failed unexpectedly")
+	assert.Equal(t, previousCert.Certificate, unmodifiedCert.Certificate)
+
+	reloaded, err = impl.tls.reload(impl.config)
+	assert.NoError(t, err, "reload failed unexpectedly")
+	assert.False(t, reloaded)
+}
+
+func TestVaultAPIReloadsChangedCAPath(t *testing.T) {
+	dir := t.TempDir()
+	impl, err := newVaultAPIImpl(VaultTLSConfig{CAPath: dir}, false, time.Minute)
+	assert.NoError(t, err, "newVaultAPIImpl failed unexpectedly")
+
+	caCert, _ := test.WriteCertificate(t, t.TempDir(), "ca")
+	assert.NoError(t, os.Rename(caCert, filepath.Join(dir, "ca.pem")))
+
+	reloaded, err := impl.tls.reload(impl.config)
+	assert.NoError(t, err, "reload failed unexpectedly")
+	assert.True(t, reloaded)
+	assert.NotNil(t, transportTLSConfig(t, impl).RootCAs)
+}
+
+func transportTLSConfig(t *testing.T, impl vaultAPIImpl) *tls.Config {
+	t.Helper()
+
+	transport, ok := impl.config.HttpClient.Transport.(*http.Transport)
+	assert.True(t, ok, "unexpected transport %T", impl.config.HttpClient.Transport)
+	return transport.TLSClientConfig
+}
+
+func assertClientCertificate(t *testing.T, impl vaultAPIImpl, certFile string) {
+	t.Helper()
+
+	data, err := os.ReadFile(certFile)
+	assert.NoError(t, err, "could not read certificate")
+	block, _ := pem.Decode(data)
+
+	cert, err := transportTLSConfig(t, impl).GetClientCertificate(&tls.CertificateRequestInfo{})
+	assert.NoError(t, err, "GetClientCertificate failed unexpectedly")
+	assert.Equal(t, block.Bytes, cert.Certificate[0])
+}